@@ -0,0 +1,92 @@
+// Package config хранит пользовательские файлы метронома в каталоге
+// настроек по XDG: $XDG_CONFIG_HOME/smart-metronome, а если переменная
+// не задана - ~/.config/smart-metronome.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const appName = "smart-metronome"
+
+// Config - пользовательские настройки метронома
+type Config struct {
+	// Задержка звука относительно событий, измеренная командой calibrate
+	LatencyMs int `json:"latency_ms"`
+}
+
+// Latency возвращает задержку звука
+func (c *Config) Latency() time.Duration {
+	return time.Duration(c.LatencyMs) * time.Millisecond
+}
+
+// Dir возвращает каталог настроек метронома
+func Dir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить каталог настроек: %w", err)
+	}
+	return filepath.Join(base, appName), nil
+}
+
+// SessionFile возвращает путь к файлу последней сессии
+func SessionFile() (string, error) {
+	return inDir("session.json")
+}
+
+// Load загружает настройки. Если файла еще нет, возвращаются настройки
+// по умолчанию.
+func Load() (*Config, error) {
+	filename, err := inDir("config.json")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения настроек: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга настроек: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Save сохраняет настройки
+func (c *Config) Save() error {
+	filename, err := inDir("config.json")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("ошибка создания директории: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи настроек: %w", err)
+	}
+	return nil
+}
+
+// inDir возвращает путь к файлу name в каталоге настроек
+func inDir(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
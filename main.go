@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"smart-metronome/config"
 	"smart-metronome/metronome"
 	"smart-metronome/patterns"
 	"smart-metronome/ui/cli"
@@ -21,6 +29,60 @@ var (
 	output    string
 	visualize bool
 	tap       bool
+	resume    bool
+
+	timeSig  string
+	beatUnit string
+	subdiv   int
+	grouping string
+
+	rampTo      float64
+	rampBars    int
+	rampSeconds float64
+	rampCurve   string
+
+	trainStart    int
+	trainStep     int
+	trainInterval int
+	trainTarget   int
+	trainRepeat   int
+	trainCoolDown bool
+
+	playBars int
+	muteBars int
+	muteProb float64
+	muteSeed int64
+
+	humanizeMs  float64
+	humanizeVel float64
+
+	fillName  string
+	fillEvery int
+	fillCrash bool
+
+	countInBars int
+	countInHalf bool
+
+	polyBPM []int
+	polyPan []float64
+
+	sessionDuration time.Duration
+	sessionBars     int
+	summaryJSON     bool
+	summaryOut      = os.Stdout
+
+	euclidRotate int
+	euclidUnit   int
+	euclidSound  string
+	euclidLayers []string
+	euclidSave   string
+
+	calibrateBPM    int
+	calibrateClicks int
+
+	importName   string
+	exportOut    string
+	patternForce bool
 )
 
 func main() {
@@ -29,6 +91,11 @@ func main() {
 		Short: "Умный метроном с паттернами",
 		Long: `Продвинутый метроном для музыкантов с поддержкой сложных ритмических паттернов,
 полиритмий и визуализацией.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			for _, err := range patterns.LoadUserPatterns() {
+				fmt.Fprintf(os.Stderr, "Пользовательский паттерн пропущен: %v\n", err)
+			}
+		},
 	}
 
 	// Команда запуска метронома
@@ -43,6 +110,15 @@ func main() {
 	startCmd.Flags().StringVarP(&pattern, "pattern", "p", "basic", "Ритмический паттерн")
 	startCmd.Flags().StringVarP(&output, "output", "o", "speaker", "Выход: speaker, wav, или both")
 	startCmd.Flags().BoolVarP(&visualize, "visualize", "v", false, "Включить визуализацию")
+	startCmd.Flags().BoolVar(&resume, "resume", false, "Продолжить последнюю сохраненную сессию")
+	addMeterFlags(startCmd)
+	startCmd.Flags().StringVar(&grouping, "grouping", "", "Группировка аддитивного размера, например 2+2+3/8")
+	addRampFlags(startCmd)
+	addMuteFlags(startCmd)
+	addHumanizeFlags(startCmd)
+	addFillFlags(startCmd)
+	addCountInFlags(startCmd)
+	addSessionFlags(startCmd)
 
 	// Команда для режима тапа
 	var tapCmd = &cobra.Command{
@@ -58,6 +134,67 @@ func main() {
 		Run:   showPatterns,
 	}
 
+	// Генератор евклидовых ритмов
+	var euclidCmd = &cobra.Command{
+		Use:   "euclid k n",
+		Short: "Построить паттерн из евклидова ритма E(k,n)",
+		Example: `  metronome patterns euclid 5 8 --rotate 2 --save clave
+  metronome patterns euclid 3 8 --sound cowbell --layer 5,16:rim --save cow`,
+		Args: cobra.ExactArgs(2),
+		Run:  runEuclid,
+	}
+
+	euclidCmd.Flags().IntVar(&euclidRotate, "rotate", 0, "Сдвиг ритма влево в шагах")
+	euclidCmd.Flags().IntVar(&euclidUnit, "unit", 8, "Длительность шага: 8 - восьмые, 16 - шестнадцатые")
+	euclidCmd.Flags().StringVar(&euclidSound, "sound", "normal", "Звук ударов")
+	euclidCmd.Flags().StringArrayVar(&euclidLayers, "layer", nil, "Дополнительный голос \"k,n[,сдвиг][:звук]\" (можно несколько)")
+	euclidCmd.Flags().StringVar(&euclidSave, "save", "", "Сохранить паттерн под этим именем")
+	patternsCmd.AddCommand(euclidCmd)
+
+	// Проверка файлов паттернов
+	var validateCmd = &cobra.Command{
+		Use:     "validate file.json...",
+		Short:   "Проверить JSON-файлы паттернов",
+		Example: `  metronome patterns validate my-groove.json`,
+		Args:    cobra.MinimumNArgs(1),
+		Run:     runValidatePatterns,
+	}
+	patternsCmd.AddCommand(validateCmd)
+
+	// Библиотека пользовательских паттернов
+	var importCmd = &cobra.Command{
+		Use:   "import file.json",
+		Short: "Добавить паттерн из файла в свою библиотеку",
+		Args:  cobra.ExactArgs(1),
+		Run:   runImportPattern,
+	}
+	importCmd.Flags().StringVar(&importName, "name", "", "Имя в библиотеке (по умолчанию - из файла)")
+	importCmd.Flags().BoolVar(&patternForce, "force", false, "Заменить паттерн с тем же именем")
+
+	var exportCmd = &cobra.Command{
+		Use:   "export name",
+		Short: "Сохранить паттерн в JSON-файл",
+		Args:  cobra.ExactArgs(1),
+		Run:   runExportPattern,
+	}
+	exportCmd.Flags().StringVarP(&exportOut, "output", "o", "", "Файл (по умолчанию name.json, \"-\" - в консоль)")
+	exportCmd.Flags().BoolVar(&patternForce, "force", false, "Перезаписать существующий файл")
+
+	var deleteCmd = &cobra.Command{
+		Use:   "delete name",
+		Short: "Удалить паттерн из своей библиотеки",
+		Args:  cobra.ExactArgs(1),
+		Run:   runDeletePattern,
+	}
+
+	var renameCmd = &cobra.Command{
+		Use:   "rename old new",
+		Short: "Переименовать паттерн в своей библиотеке",
+		Args:  cobra.ExactArgs(2),
+		Run:   runRenamePattern,
+	}
+	patternsCmd.AddCommand(importCmd, exportCmd, deleteCmd, renameCmd)
+
 	// Команда для генерации WAV файла
 	var generateCmd = &cobra.Command{
 		Use:   "generate [output.wav]",
@@ -69,6 +206,12 @@ func main() {
 	generateCmd.Flags().IntVarP(&bpm, "bpm", "b", 120, "Темп (удары в минуту)")
 	generateCmd.Flags().IntVarP(&beats, "beats", "c", 4, "Количество долей в такте")
 	generateCmd.Flags().StringVarP(&pattern, "pattern", "p", "basic", "Ритмический паттерн")
+	addMeterFlags(generateCmd)
+	addRampFlags(generateCmd)
+	addMuteFlags(generateCmd)
+	addHumanizeFlags(generateCmd)
+	addFillFlags(generateCmd)
+	addCountInFlags(generateCmd)
 
 	// Команда для запуска веб-интерфейса
 	var webCmd = &cobra.Command{
@@ -80,7 +223,65 @@ func main() {
 	webCmd.Flags().IntVarP(&bpm, "bpm", "b", 120, "Темп по умолчанию")
 	webCmd.Flags().StringVarP(&pattern, "pattern", "p", "basic", "Паттерн по умолчанию")
 
-	rootCmd.AddCommand(startCmd, tapCmd, patternsCmd, generateCmd, webCmd)
+	// Команда тренажера скорости
+	var trainCmd = &cobra.Command{
+		Use:   "train",
+		Short: "Тренажер скорости: темп растет каждые N тактов",
+		Run:   runTrainer,
+	}
+
+	trainCmd.Flags().IntVarP(&trainStart, "start", "s", 100, "Начальный темп")
+	trainCmd.Flags().IntVar(&trainStep, "step", 5, "Прибавка темпа за шаг (BPM)")
+	trainCmd.Flags().IntVarP(&trainInterval, "interval", "i", 4, "Количество тактов на каждом темпе")
+	trainCmd.Flags().IntVarP(&trainTarget, "target", "t", 160, "Целевой темп")
+	trainCmd.Flags().IntVarP(&trainRepeat, "repeat", "r", 1, "Количество циклов разгона (0 - бесконечно)")
+	trainCmd.Flags().BoolVar(&trainCoolDown, "cooldown", false, "После цели вернуться к начальному темпу")
+	trainCmd.Flags().IntVarP(&beats, "beats", "c", 4, "Количество долей в такте")
+	addMeterFlags(trainCmd)
+	trainCmd.Flags().StringVarP(&pattern, "pattern", "p", "basic", "Ритмический паттерн")
+	trainCmd.Flags().BoolVarP(&visualize, "visualize", "v", false, "Включить визуализацию")
+	addSessionFlags(trainCmd)
+
+	// Команды для режима песни
+	var songCmd = &cobra.Command{
+		Use:   "song",
+		Short: "Воспроизведение структуры песни по разделам",
+	}
+
+	var songPlayCmd = &cobra.Command{
+		Use:   "play [song.json]",
+		Short: "Сыграть песню из JSON файла",
+		Args:  cobra.ExactArgs(1),
+		Run:   runSong,
+	}
+
+	songPlayCmd.Flags().BoolVarP(&visualize, "visualize", "v", false, "Включить визуализацию")
+	addCountInFlags(songPlayCmd)
+	songCmd.AddCommand(songPlayCmd)
+
+	// Команда политемпа
+	var polyCmd = &cobra.Command{
+		Use:   "poly",
+		Short: "Несколько потоков с независимыми темпами (политемп)",
+		Run:   runPolytempo,
+	}
+
+	polyCmd.Flags().IntSliceVarP(&polyBPM, "bpm", "b", []int{120, 93}, "Темпы потоков через запятую")
+	polyCmd.Flags().Float64SliceVar(&polyPan, "pan", nil, "Панорама потоков от -1 (лево) до 1 (право)")
+	polyCmd.Flags().StringVarP(&pattern, "pattern", "p", "basic", "Ритмический паттерн всех потоков")
+	polyCmd.Flags().BoolVarP(&visualize, "visualize", "v", false, "Включить визуализацию")
+
+	// Команда калибровки задержки звука
+	var calibrateCmd = &cobra.Command{
+		Use:   "calibrate",
+		Short: "Измерить задержку звука, отстукивая щелчки",
+		Run:   runCalibration,
+	}
+
+	calibrateCmd.Flags().IntVarP(&calibrateBPM, "bpm", "b", 100, "Темп щелчков")
+	calibrateCmd.Flags().IntVarP(&calibrateClicks, "clicks", "n", 16, "Количество щелчков")
+
+	rootCmd.AddCommand(startCmd, tapCmd, patternsCmd, generateCmd, webCmd, trainCmd, songCmd, polyCmd, calibrateCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -88,24 +289,301 @@ func main() {
 	}
 }
 
-func runMetronome(cmd *cobra.Command, args []string) {
-	// Загружаем паттерн
-	pat, err := patterns.LoadPattern(pattern)
+// addMeterFlags добавляет флаги размера, счетной доли и подразделений
+func addMeterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&timeSig, "time", "", "Размер, например 6/8 (по умолчанию - из паттерна)")
+	cmd.Flags().StringVar(&beatUnit, "beat-unit", "", "Счетная доля темпа: 4, 8, 4. (с точкой)")
+	cmd.Flags().IntVar(&subdiv, "subdiv", 0, "Подразделение долей: 2, 3, 4, 5, 7...")
+}
+
+// applyMeterFlags выбирает размер: явный --time, затем --beats четвертями,
+// а если ни то ни другое не задано - размер самого паттерна
+func applyMeterFlags(cmd *cobra.Command, metro *metronome.Metronome, pat *metronome.Pattern) error {
+	var ts metronome.TimeSignature
+	var unit metronome.NoteValue
+	var err error
+
+	switch {
+	case timeSig != "":
+		if ts, err = metronome.ParseTimeSignature(timeSig); err != nil {
+			return err
+		}
+	case cmd.Flags().Changed("beats"):
+		ts = metronome.CommonTime(beats)
+	default:
+		ts = pat.TimeSignature()
+		unit = pat.DefaultBeatUnit()
+	}
+
+	if beatUnit != "" {
+		if unit, err = metronome.ParseNoteValue(beatUnit); err != nil {
+			return err
+		}
+	}
+
+	if err := metro.SetTimeSignature(ts, unit); err != nil {
+		return err
+	}
+	return metro.SetSubdivision(subdiv)
+}
+
+// describeMeter возвращает размер для вывода, со счетной долей если она
+// отличается от пульсации
+func describeMeter(metro *metronome.Metronome) string {
+	if metro.BeatUnit == metro.TimeSignature.Pulse() {
+		return metro.TimeSignature.String()
+	}
+	return fmt.Sprintf("%s (темп в долях %s)", metro.TimeSignature, metro.BeatUnit)
+}
+
+// addRampFlags добавляет флаги плавного изменения темпа
+func addRampFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&rampTo, "ramp-to", 0, "Целевой темп для плавного перехода")
+	cmd.Flags().IntVar(&rampBars, "ramp-bars", 0, "Длительность перехода в тактах")
+	cmd.Flags().Float64Var(&rampSeconds, "ramp-seconds", 0, "Длительность перехода в секундах")
+	cmd.Flags().StringVar(&rampCurve, "ramp-curve", "linear", "Кривая перехода: linear или exp")
+}
+
+// applyRampFlags настраивает переход темпа, если задан --ramp-to
+func applyRampFlags(metro *metronome.Metronome) error {
+	if rampTo == 0 {
+		return nil
+	}
+
+	curve, err := metronome.ParseRampCurve(rampCurve)
 	if err != nil {
-		log.Fatalf("Ошибка загрузки паттерна: %v", err)
+		return err
 	}
 
-	// Создаем метроном
-	metro, err := metronome.NewMetronome(bpm, beats, pat)
+	return metro.RampTo(metronome.TempoRamp{
+		To:       rampTo,
+		Bars:     rampBars,
+		Duration: time.Duration(rampSeconds * float64(time.Second)),
+		Curve:    curve,
+	})
+}
+
+// addMuteFlags добавляет флаги тренировки внутренних часов
+func addMuteFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&playBars, "play-bars", 0, "Тактов со звуком перед паузой")
+	cmd.Flags().IntVar(&muteBars, "mute-bars", 0, "Тактов тишины после звучащих")
+	cmd.Flags().Float64Var(&muteProb, "mute-prob", 0, "Вероятность заглушить отдельную долю (0-1)")
+	cmd.Flags().Int64Var(&muteSeed, "seed", 0, "Зерно случайности приглушения, humanize и условий долей (0 - случайное)")
+}
+
+// applyMuteFlags настраивает приглушение, если задан любой из флагов
+func applyMuteFlags(metro *metronome.Metronome) error {
+	if muteBars == 0 && muteProb == 0 {
+		return nil
+	}
+
+	return metro.SetMuteRules(metronome.MuteRules{
+		PlayBars:    playBars,
+		MuteBars:    muteBars,
+		Probability: muteProb,
+		Seed:        muteSeed,
+	})
+}
+
+// addHumanizeFlags добавляет флаги отклонений от сетки. Зерно берется
+// из общего флага --seed.
+func addHumanizeFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&humanizeMs, "humanize", 0, "Разброс времени ударов в мс (±)")
+	cmd.Flags().Float64Var(&humanizeVel, "humanize-velocity", 0, "Разброс громкости ударов (0-1)")
+}
+
+// applyHumanizeFlags задает отклонения, если указан любой из флагов;
+// иначе действуют настройки паттерна
+func applyHumanizeFlags(metro *metronome.Metronome) error {
+	if humanizeMs == 0 && humanizeVel == 0 {
+		return nil
+	}
+
+	return metro.SetHumanize(metronome.Humanize{
+		TimingMs: humanizeMs,
+		Velocity: humanizeVel,
+		Seed:     muteSeed,
+	})
+}
+
+// addFillFlags добавляет флаги сбивки
+func addFillFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&fillName, "fill", "", "Паттерн сбивки, заменяющий такт основного, например rock-fill")
+	cmd.Flags().IntVar(&fillEvery, "fill-every", 4, "Каждый какой такт играть сбивку")
+	cmd.Flags().BoolVar(&fillCrash, "crash", false, "Тарелка на первой доле после сбивки")
+}
+
+// applyFillFlags задает сбивку, если она указана; иначе действует
+// сбивка паттерна
+func applyFillFlags(metro *metronome.Metronome) error {
+	if fillName == "" {
+		return nil
+	}
+
+	fill := metronome.Fill{Pattern: fillName, Every: fillEvery, Crash: fillCrash}
+	if err := fill.Resolve(patterns.LoadPattern); err != nil {
+		return err
+	}
+	return metro.SetFill(fill)
+}
+
+// addCountInFlags добавляет флаги отсчета перед началом
+func addCountInFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&countInBars, "count-in", 0, "Тактов отсчета перед началом")
+	cmd.Flags().BoolVar(&countInHalf, "count-in-half", false, "Половинный счет отсчета: 1 . 2 . 1 2 3 4")
+}
+
+// applyCountInFlags настраивает отсчет по флагам
+func applyCountInFlags(metro *metronome.Metronome) error {
+	return metro.SetCountIn(metronome.CountIn{Bars: countInBars, HalfTime: countInHalf})
+}
+
+// addSessionFlags добавляет флаги предела занятия и итогов
+func addSessionFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&sessionDuration, "duration", 0, "Длительность занятия, например 10m (доигрывается до конца такта)")
+	cmd.Flags().IntVar(&sessionBars, "bars", 0, "Сколько тактов играть")
+	cmd.Flags().BoolVar(&summaryJSON, "json", false, "Вывести итоги занятия в JSON")
+}
+
+// progressOut возвращает, куда печатать ход занятия. С --json это stderr,
+// чтобы в stdout остались только итоги.
+func progressOut() io.Writer {
+	if summaryJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// applySessionFlags задает предел занятия, если он указан, и направляет
+// вывод метронома в progressOut.
+func applySessionFlags(metro *metronome.Metronome) error {
+	metro.SetProgressWriter(progressOut())
+	if sessionDuration == 0 && sessionBars == 0 {
+		return nil
+	}
+	return metro.SetSessionLimit(metronome.SessionLimit{Duration: sessionDuration, Bars: sessionBars})
+}
+
+// printSummary печатает итоги занятия
+func printSummary(summary metronome.SessionSummary) {
+	if summaryJSON {
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			log.Fatalf("Ошибка сериализации итогов: %v", err)
+		}
+		fmt.Fprintln(summaryOut, string(data))
+		return
+	}
+
+	fmt.Fprintln(summaryOut, "\n📊 Итоги занятия")
+	fmt.Fprintf(summaryOut, "   Тактов: %d\n", summary.Bars)
+	fmt.Fprintf(summaryOut, "   Время: %s\n", summary.Played().Round(time.Second))
+	if summary.TempoMin == summary.TempoMax {
+		fmt.Fprintf(summaryOut, "   Темп: %.0f BPM\n", summary.TempoMin)
+	} else {
+		fmt.Fprintf(summaryOut, "   Темп: %.0f–%.0f BPM\n", summary.TempoMin, summary.TempoMax)
+	}
+	fmt.Fprintf(summaryOut, "   Паттерн: %s\n", strings.Join(summary.Patterns, " → "))
+}
+
+// applyConfig применяет к метроному пользовательские настройки
+func applyConfig(metro *metronome.Metronome) {
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Ошибка создания метронома: %v", err)
+		log.Printf("Настройки не загружены: %v", err)
+		return
 	}
+	if err := metro.SetLatency(cfg.Latency()); err != nil {
+		log.Printf("Задержка звука из настроек не применена: %v", err)
+	}
+}
 
-	fmt.Printf("🎵 Метроном запущен\n")
-	fmt.Printf("   Темп: %d BPM\n", bpm)
-	fmt.Printf("   Такт: %d/4\n", beats)
-	fmt.Printf("   Паттерн: %s\n", pattern)
-	fmt.Printf("   Нажмите Ctrl+C для остановки\n\n")
+func runMetronome(cmd *cobra.Command, args []string) {
+	var metro *metronome.Metronome
+	if resume {
+		metro = resumeSession()
+		bpm = metro.BPM
+		pattern = metro.Pattern.Name
+	} else {
+		// Загружаем паттерн
+		pat, err := patterns.LoadPattern(pattern)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки паттерна: %v", err)
+		}
+
+		// Создаем метроном
+		metro, err = metronome.NewMetronome(bpm, beats, pat)
+		if err != nil {
+			log.Fatalf("Ошибка создания метронома: %v", err)
+		}
+		if err := applyMeterFlags(cmd, metro, pat); err != nil {
+			log.Fatalf("Ошибка размера: %v", err)
+		}
+		if grouping != "" {
+			g, err := metronome.ParseGrouping(grouping)
+			if err == nil {
+				err = metro.SetGrouping(g)
+			}
+			if err != nil {
+				log.Fatalf("Ошибка группировки: %v", err)
+			}
+		}
+	}
+	if err := applyRampFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки перехода темпа: %v", err)
+	}
+	if err := applyMuteFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки приглушения: %v", err)
+	}
+	if err := applyHumanizeFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки humanize: %v", err)
+	}
+	metro.SetTrigSeed(muteSeed)
+	if err := applyFillFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки сбивки: %v", err)
+	}
+	if err := applyCountInFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки отсчета: %v", err)
+	}
+	if err := applySessionFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки занятия: %v", err)
+	}
+	applyConfig(metro)
+
+	out := progressOut()
+	fmt.Fprintf(out, "🎵 Метроном запущен\n")
+	fmt.Fprintf(out, "   Темп: %d BPM\n", bpm)
+	if rampTo != 0 {
+		fmt.Fprintf(out, "   Переход: до %.0f BPM (%s)\n", rampTo, rampCurve)
+	}
+	if muteBars > 0 {
+		fmt.Fprintf(out, "   Паузы: %d такт(а) со звуком, %d без\n", playBars, muteBars)
+	}
+	if humanizeMs > 0 || humanizeVel > 0 {
+		fmt.Fprintf(out, "   Humanize: ±%.0f мс, громкость ±%.0f%%\n", humanizeMs, humanizeVel*100)
+	}
+	if countInBars > 0 {
+		fmt.Fprintf(out, "   Отсчет: %d такт(а)\n", countInBars)
+	}
+	if sessionDuration > 0 {
+		fmt.Fprintf(out, "   Занятие: %s\n", sessionDuration)
+	}
+	if sessionBars > 0 {
+		fmt.Fprintf(out, "   Занятие: %d такт(ов)\n", sessionBars)
+	}
+	fmt.Fprintf(out, "   Такт: %s\n", describeMeter(metro))
+	if grouping != "" {
+		fmt.Fprintf(out, "   Группы: %s\n", grouping)
+	} else if metro.Pattern.Grouping != "" {
+		fmt.Fprintf(out, "   Группы: %s\n", metro.Pattern.Grouping)
+	}
+	fmt.Fprintf(out, "   Паттерн: %s\n", pattern)
+	if fillName != "" {
+		fmt.Fprintf(out, "   Сбивка: %s каждый %d-й такт\n", fillName, fillEvery)
+	} else if f := metro.Pattern.Fill; f != nil {
+		fmt.Fprintf(out, "   Сбивка: %s\n", f.Pattern)
+	}
+	fmt.Fprintf(out, "   Нажмите Ctrl+C для остановки\n\n")
 
 	// Запускаем CLI интерфейс если нужно
 	if visualize {
@@ -118,23 +596,290 @@ func runMetronome(cmd *cobra.Command, args []string) {
 		if err := metro.GenerateWAV(filename, 60); err != nil {
 			log.Printf("Ошибка генерации WAV: %v", err)
 		} else {
-			fmt.Printf("Файл сохранен: %s\n", filename)
+			fmt.Fprintf(out, "Файл сохранен: %s\n", filename)
 		}
 	}
 
 	if output == "speaker" || output == "both" {
-		if err := metro.Start(); err != nil {
-			log.Fatalf("Ошибка запуска: %v", err)
+		playUntilInterrupted(metro)
+	}
+}
+
+// resumeSession создает метроном по последней сохраненной сессии
+func resumeSession() *metronome.Metronome {
+	filename, err := config.SessionFile()
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	st, err := metronome.LoadStateFromFile(filename)
+	if err != nil {
+		log.Fatalf("Не удалось загрузить сессию: %v", err)
+	}
+
+	pat, err := patterns.LoadPattern(st.Pattern)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки паттерна: %v", err)
+	}
+	metro, err := metronome.NewMetronome(st.BPM, st.TimeSignature.Numerator, pat)
+	if err != nil {
+		log.Fatalf("Ошибка создания метронома: %v", err)
+	}
+	if err := metro.Restore(*st, patterns.LoadPattern); err != nil {
+		log.Fatalf("Ошибка восстановления сессии: %v", err)
+	}
+
+	fmt.Fprintf(progressOut(), "↻ Продолжаем сессию от %s с такта %d\n", st.SavedAt.Format("02.01.2006 15:04"), max(st.Bar, 1))
+	return metro
+}
+
+// saveSession запоминает состояние метронома для start --resume
+func saveSession(metro *metronome.Metronome) {
+	filename, err := config.SessionFile()
+	if err == nil {
+		err = metro.GetState().SaveToFile(filename)
+	}
+	if err != nil {
+		log.Printf("Не удалось сохранить сессию: %v", err)
+	}
+}
+
+// playUntilInterrupted запускает метроном и играет до сигнала завершения
+// или до конца занятия, после чего печатает итоги
+func playUntilInterrupted(metro *metronome.Metronome) {
+	if err := metro.Start(); err != nil {
+		log.Fatalf("Ошибка запуска: %v", err)
+	}
+
+	// Ожидаем сигнала завершения
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sigChan:
+		saveSession(metro)
+		metro.Stop()
+		fmt.Fprintln(progressOut(), "\nМетроном остановлен")
+	case <-metro.Done():
+		fmt.Fprintln(progressOut(), "\nЗанятие завершено")
+	}
+
+	printSummary(metro.Summary())
+}
+
+func runTrainer(cmd *cobra.Command, args []string) {
+	pat, err := patterns.LoadPattern(pattern)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки паттерна: %v", err)
+	}
+
+	metro, err := metronome.NewMetronome(trainStart, beats, pat)
+	if err != nil {
+		log.Fatalf("Ошибка создания метронома: %v", err)
+	}
+
+	cfg := metronome.TrainerConfig{
+		Start:    trainStart,
+		Step:     trainStep,
+		Interval: trainInterval,
+		Target:   trainTarget,
+		Repeat:   trainRepeat,
+		CoolDown: trainCoolDown,
+	}
+	if err := applyMeterFlags(cmd, metro, pat); err != nil {
+		log.Fatalf("Ошибка размера: %v", err)
+	}
+	if err := metro.SetTrainer(cfg); err != nil {
+		log.Fatalf("Ошибка настройки тренажера: %v", err)
+	}
+	if err := applySessionFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки занятия: %v", err)
+	}
+	applyConfig(metro)
+
+	out := progressOut()
+	fmt.Fprintf(out, "🏋 Тренажер скорости запущен\n")
+	fmt.Fprintf(out, "   Темп: %d → %d BPM, шаг %+d каждые %d такт(а)\n",
+		trainStart, trainTarget, trainStep, trainInterval)
+	if trainCoolDown {
+		fmt.Fprintf(out, "   После цели - возврат к %d BPM\n", trainStart)
+	}
+	fmt.Fprintf(out, "   Паттерн: %s\n", pattern)
+	fmt.Fprintf(out, "   Нажмите Ctrl+C для остановки\n\n")
+
+	if visualize {
+		go cli.RunVisualization(metro)
+	}
+
+	playUntilInterrupted(metro)
+}
+
+func runSong(cmd *cobra.Command, args []string) {
+	song, err := metronome.LoadSongFromFile(args[0])
+	if err != nil {
+		log.Fatalf("Ошибка загрузки песни: %v", err)
+	}
+	if err := song.Resolve(patterns.LoadPattern); err != nil {
+		log.Fatalf("Ошибка в песне: %v", err)
+	}
+
+	metro, err := metronome.NewSongMetronome(song)
+	if err != nil {
+		log.Fatalf("Ошибка создания метронома: %v", err)
+	}
+	if err := applyCountInFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки отсчета: %v", err)
+	}
+	applyConfig(metro)
+
+	fmt.Printf("🎼 Песня: %s\n", song.Name)
+	for _, sec := range song.Sections {
+		repeat := ""
+		if sec.Repeat > 1 {
+			repeat = fmt.Sprintf(" x%d", sec.Repeat)
 		}
+		fmt.Printf("   • %-10s %3d такт(ов)%s\n", sec.Name, sec.Bars, repeat)
+	}
+	fmt.Printf("   Нажмите Ctrl+C для остановки\n\n")
+
+	// Следим за сменой разделов до конца песни
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if visualize {
+		go cli.RunVisualization(metro)
+	} else {
+		sub := metro.SubscribeEvents(ctx, metronome.OnlyKinds(metronome.KindBeat))
+		go func() {
+			for ev := range sub.Events() {
+				event := ev.(metronome.BeatEvent)
+				if event.SectionChanged {
+					fmt.Printf("\n▶ %s (%.0f BPM, %s)", event.Section, event.Tempo, event.TimeSignature)
+					if event.Modulation != nil {
+						fmt.Printf(" модуляция %s", event.Modulation)
+					}
+				}
+			}
+		}()
+	}
 
-		// Ожидаем сигнала завершения
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		<-sigChan
+	if err := metro.Start(); err != nil {
+		log.Fatalf("Ошибка запуска: %v", err)
+	}
 
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sigChan:
 		metro.Stop()
 		fmt.Println("\nМетроном остановлен")
+	case <-metro.Done():
+		fmt.Println("\nПесня завершена")
+	}
+}
+
+func runPolytempo(cmd *cobra.Command, args []string) {
+	if len(polyPan) > 0 && len(polyPan) != len(polyBPM) {
+		log.Fatalf("Количество значений --pan должно совпадать с количеством темпов")
+	}
+
+	members := make([]*metronome.Metronome, len(polyBPM))
+	for i, tempo := range polyBPM {
+		// У каждого потока свой экземпляр паттерна
+		pat, err := patterns.LoadPattern(pattern)
+		if err != nil {
+			log.Fatalf("Ошибка загрузки паттерна: %v", err)
+		}
+
+		metro, err := metronome.NewMetronome(tempo, pat.TimeSignature().Numerator, pat)
+		if err != nil {
+			log.Fatalf("Ошибка создания потока %d: %v", i+1, err)
+		}
+
+		// По умолчанию потоки разносятся по панораме равномерно
+		if len(polyPan) > 0 {
+			metro.Pan = polyPan[i]
+		} else if len(polyBPM) > 1 {
+			metro.Pan = -0.8 + 1.6*float64(i)/float64(len(polyBPM)-1)
+		}
+		applyConfig(metro)
+		members[i] = metro
+	}
+
+	ens, err := metronome.NewEnsemble(members...)
+	if err != nil {
+		log.Fatalf("Ошибка создания ансамбля: %v", err)
+	}
+
+	fmt.Printf("🎵 Политемп запущен\n")
+	for i, metro := range members {
+		fmt.Printf("   Поток %d: %d BPM, панорама %+.2f\n", i+1, metro.BPM, metro.Pan)
+	}
+	fmt.Printf("   Паттерн: %s\n", pattern)
+	fmt.Printf("   Нажмите Ctrl+C для остановки\n\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if visualize {
+		go cli.RunPolyVisualization(ens)
+	} else {
+		// Отмечаем сильные доли каждого потока
+		for i, metro := range members {
+			sub := metro.SubscribeEvents(ctx, metronome.OnlyKinds(metronome.KindBarStart))
+			go func() {
+				for ev := range sub.Events() {
+					fmt.Printf("[поток %d] такт %d\n", i+1, ev.(metronome.BarStart).Bar)
+				}
+			}()
+		}
+	}
+
+	if err := ens.Start(); err != nil {
+		log.Fatalf("Ошибка запуска: %v", err)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+
+	ens.Stop()
+	fmt.Println("\nМетроном остановлен")
+}
+
+func runCalibration(cmd *cobra.Command, args []string) {
+	pat, err := patterns.LoadPattern("basic")
+	if err != nil {
+		log.Fatalf("Ошибка загрузки паттерна: %v", err)
+	}
+	metro, err := metronome.NewMetronome(calibrateBPM, 4, pat)
+	if err != nil {
+		log.Fatalf("Ошибка создания метронома: %v", err)
+	}
+	// Такт отсчета, чтобы поймать темп до начала измерения
+	if err := metro.SetCountIn(metronome.CountIn{Bars: 1}); err != nil {
+		log.Fatalf("Ошибка настройки отсчета: %v", err)
+	}
+
+	ticks, taps, err := cli.RunCalibration(metro, calibrateClicks)
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	latency, err := metronome.EstimateLatency(ticks, taps)
+	if err != nil {
+		log.Fatalf("Не удалось измерить задержку: %v", err)
+	}
+	if err := metro.SetLatency(latency); err != nil {
+		log.Fatalf("Недопустимая задержка: %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	cfg.LatencyMs = int(latency.Milliseconds())
+	if err := cfg.Save(); err != nil {
+		log.Fatalf("Ошибка: %v", err)
 	}
+
+	fmt.Printf("🎯 Задержка звука: %+d мс\n", cfg.LatencyMs)
+	fmt.Println("   Сохранено в настройках, визуализация будет сдвинута на эту величину")
 }
 
 func runTapMode(cmd *cobra.Command, args []string) {
@@ -154,13 +899,146 @@ func showPatterns(cmd *cobra.Command, args []string) {
 
 	allPatterns := patterns.GetAllPatterns()
 	for name, desc := range allPatterns {
-		fmt.Printf("• %-15s - %s\n", name, desc)
+		fmt.Printf("• %-15s - %s", name, desc)
+		if pat, err := patterns.LoadPattern(name); err == nil && pat.Grouping != "" {
+			fmt.Printf(" [группы %s]", pat.Grouping)
+		}
+		if !patterns.IsBuiltin(name) {
+			fmt.Print(" [свой]")
+		}
+		fmt.Println()
 	}
 
 	fmt.Println("\nПример использования:")
 	fmt.Println("  metronome start -b 120 -p rock -v")
 }
 
+func runEuclid(cmd *cobra.Command, args []string) {
+	lead, err := metronome.ParseEuclidLayer(args[0] + "," + args[1] + "," + strconv.Itoa(euclidRotate))
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	lead.Sound = euclidSound
+
+	var layers []metronome.EuclidLayer
+	for _, spec := range euclidLayers {
+		layer, err := metronome.ParseEuclidLayer(spec)
+		if err != nil {
+			log.Fatalf("Ошибка: %v", err)
+		}
+		layers = append(layers, layer)
+	}
+
+	name := euclidSave
+	if name == "" {
+		name = fmt.Sprintf("euclid-%d-%d", lead.Hits, lead.Steps)
+	}
+	pat, err := metronome.NewEuclidPattern(name, euclidUnit, lead, layers...)
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+
+	fmt.Printf("🥁 %s (%s)\n", pat.Description, pat.Meter)
+	if euclidSave == "" {
+		fmt.Println("   Добавьте --save имя, чтобы сохранить паттерн")
+		return
+	}
+
+	filename, err := patterns.SaveUserPattern(pat)
+	if err != nil {
+		log.Fatalf("Ошибка сохранения: %v", err)
+	}
+	fmt.Printf("   Сохранен: %s\n", filename)
+	fmt.Printf("   Запуск: metronome start -p %s\n", name)
+}
+
+// runValidatePatterns проверяет файлы паттернов и печатает ошибки в виде
+// "файл:строка: поле: описание". Код выхода 1, если есть ошибки.
+func runValidatePatterns(cmd *cobra.Command, args []string) {
+	failed := false
+	for _, filename := range args {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			log.Fatalf("Ошибка чтения файла: %v", err)
+		}
+
+		pat, err := metronome.ParsePattern(data)
+		if err == nil {
+			err = pat.Resolve(patterns.LoadPattern)
+		}
+
+		var errs metronome.ValidationErrors
+		switch {
+		case errors.As(err, &errs):
+			failed = true
+			for _, e := range errs {
+				fmt.Printf("%s:%d: %s: %s\n", filename, e.Line, e.Path, e.Message)
+			}
+		case err != nil:
+			failed = true
+			fmt.Printf("%s: %v\n", filename, err)
+		default:
+			fmt.Printf("✓ %s: паттерн %s в порядке\n", filename, pat.Name)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runImportPattern(cmd *cobra.Command, args []string) {
+	pat, filename, err := patterns.ImportPattern(args[0], importName, patternForce)
+	if err != nil {
+		log.Fatalf("Ошибка импорта: %v", err)
+	}
+	fmt.Printf("📥 Паттерн %s добавлен: %s\n", pat.Name, filename)
+	fmt.Printf("   Запуск: metronome start -p %s\n", pat.Name)
+}
+
+func runExportPattern(cmd *cobra.Command, args []string) {
+	pat, err := patterns.LoadPattern(args[0])
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+
+	if exportOut == "-" {
+		data, err := json.MarshalIndent(pat, "", "  ")
+		if err != nil {
+			log.Fatalf("Ошибка сериализации: %v", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	filename := exportOut
+	if filename == "" {
+		filename = args[0] + ".json"
+	}
+	if _, err := os.Stat(filename); err == nil && !patternForce {
+		log.Fatalf("Файл %s уже существует, добавьте --force для перезаписи", filename)
+	}
+	if err := pat.SavePatternToFile(filename); err != nil {
+		log.Fatalf("Ошибка экспорта: %v", err)
+	}
+	fmt.Printf("📤 Паттерн %s сохранен в %s\n", args[0], filename)
+}
+
+func runDeletePattern(cmd *cobra.Command, args []string) {
+	if err := patterns.DeleteUserPattern(args[0]); err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	fmt.Printf("🗑  Паттерн %s удален\n", args[0])
+}
+
+func runRenamePattern(cmd *cobra.Command, args []string) {
+	filename, err := patterns.RenameUserPattern(args[0], args[1])
+	if err != nil {
+		log.Fatalf("Ошибка: %v", err)
+	}
+	fmt.Printf("✏️  Паттерн %s переименован в %s: %s\n", args[0], args[1], filename)
+}
+
 func generateWAV(cmd *cobra.Command, args []string) {
 	filename := args[0]
 
@@ -173,6 +1051,25 @@ func generateWAV(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Fatalf("Ошибка создания метронома: %v", err)
 	}
+	if err := applyMeterFlags(cmd, metro, pat); err != nil {
+		log.Fatalf("Ошибка размера: %v", err)
+	}
+	if err := applyRampFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки перехода темпа: %v", err)
+	}
+	if err := applyMuteFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки приглушения: %v", err)
+	}
+	if err := applyHumanizeFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки humanize: %v", err)
+	}
+	metro.SetTrigSeed(muteSeed)
+	if err := applyFillFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки сбивки: %v", err)
+	}
+	if err := applyCountInFlags(metro); err != nil {
+		log.Fatalf("Ошибка настройки отсчета: %v", err)
+	}
 
 	// Генерируем 60 секунд аудио
 	if err := metro.GenerateWAV(filename, 60); err != nil {
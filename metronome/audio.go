@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/faiface/beep"
@@ -41,77 +42,101 @@ func initAudio() error {
 	return nil
 }
 
-func GenerateAndPlaySound(soundType string, volume float64, bpm int) {
-	// Инициализируем аудио если еще не инициализировано
-	if soundGen == nil {
-		if err := initAudio(); err != nil {
-			fmt.Printf("Аудио недоступно: %v\n", err)
-			return
-		}
-	}
-
-	duration := time.Duration(float64(time.Minute) / float64(bpm) * 0.1)
-
-	// Определяем частоту по типу звука
-	var freq float64
+// soundVoice возвращает частоту и итоговую громкость для типа звука
+func soundVoice(soundType string, volume float64) (float64, float64) {
 	switch soundType {
 	case "accent":
-		freq = 880
+		return 880, volume
 	case "ride":
-		freq = 1318.51
+		return 1318.51, volume
 	case "normal":
-		freq = 440
+		return 440, volume
 	case "ghost":
-		freq = 220
-		volume *= 0.3
+		return 220, volume * 0.3
+	case "eighth":
+		return 660, volume
+	case "triplet":
+		return 587.33, volume
+	case "sixteenth":
+		return 990, volume
+	case "quintuplet":
+		return 523.25, volume
+	case "sextuplet":
+		return 698.46, volume
+	case "septuplet":
+		return 783.99, volume
+	case "thirtysecond":
+		return 1174.66, volume
+	case "count-accent":
+		return 2093, volume
+	case "count":
+		return 1567.98, volume
+	case "cowbell":
+		return 1046.5, volume
+	case "rim":
+		return 1975.53, volume
+	case "crash":
+		return 1760, volume
+	case "warning":
+		return 2637.02, volume
 	default:
-		freq = 440
+		return 440, volume
 	}
+}
 
-	// Создаем и проигрываем звук
-	streamer := createTone(freq, duration, volume)
-	done := make(chan bool)
-	speaker.Play(beep.Seq(streamer, beep.Callback(func() {
-		done <- true
-	})))
-	<-done
+// Sounds - типы звуков, которые умеет синтезировать метроном
+var Sounds = []string{
+	"accent", "ride", "normal", "ghost", "eighth", "triplet", "sixteenth", "quintuplet",
+	"sextuplet", "septuplet", "thirtysecond", "count-accent", "count", "cowbell", "rim",
+	"crash", "warning", "silent",
 }
 
-// createTone создает тональный сигнал
-func createTone(freq float64, duration time.Duration, volume float64) beep.Streamer {
-	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
-		numSamples := len(samples)
-		if numSamples == 0 {
-			return 0, false
-		}
+// KnownSound сообщает, есть ли такой тип звука
+func KnownSound(name string) bool {
+	return slices.Contains(Sounds, name)
+}
 
-		// Вычисляем количество семплов для указанной длительности
-		maxSamples := int(soundGen.sampleRate.D(int(duration)))
-		if maxSamples <= 0 {
-			return 0, false
-		}
+// renderClick рендерит щелчок длиной numSamples семплов (моно).
+// Используется и для динамика, и для WAV, поэтому звучат они одинаково.
+func renderClick(soundType string, volume float64, numSamples int) []float64 {
+	freq, volume := soundVoice(soundType, volume)
 
-		// Ограничиваем количество семплов
-		if numSamples > maxSamples {
-			numSamples = maxSamples
-		}
+	samples := make([]float64, numSamples)
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+		val := math.Sin(2 * math.Pi * freq * t)
 
-		// Генерируем синусоидальную волну
-		for i := 0; i < numSamples; i++ {
-			t := float64(i) / float64(soundGen.sampleRate)
-			val := math.Sin(2 * math.Pi * freq * t)
+		// Применяем огибающую ADSR
+		samples[i] = val * volume * adsrEnvelope(i, numSamples)
+	}
+	return samples
+}
 
-			// Применяем огибающую ADSR
-			envelope := adsrEnvelope(i, numSamples)
-			val *= volume * envelope
+// renderEvent рендерит все звуки события: основной щелчок и удары слоев
+// полиритмии. Длительность каждого звука - 10% от его интервала.
+func renderEvent(event TickEvent) []float64 {
+	if event.Muted {
+		return nil
+	}
 
-			// Записываем в оба канала (стерео)
-			samples[i][0] = val
-			samples[i][1] = val
+	var out []float64
+	mix := func(click []float64) {
+		if len(click) > len(out) {
+			out = append(out, make([]float64, len(click)-len(out))...)
+		}
+		for i, val := range click {
+			out[i] += val
 		}
+	}
+
+	if event.Audible() {
+		mix(renderClick(event.Sound, event.Volume, event.length/10))
+	}
+	for _, hit := range event.Hits {
+		mix(renderClick(hit.Sound, hit.Volume, hit.length/10))
+	}
 
-		return numSamples, numSamples < maxSamples
-	})
+	return out
 }
 
 // adsrEnvelope создает ADSR огибающую
@@ -140,7 +165,7 @@ func adsrEnvelope(sample, totalSamples int) float64 {
 
 // GenerateWAV создает WAV файл с метрономом
 func (m *Metronome) GenerateWAV(filename string, durationSeconds int) error {
-	fmt.Printf("Генерация WAV файла: %s (%d секунд)...\n", filename, durationSeconds)
+	fmt.Fprintf(m.progress, "Генерация WAV файла: %s (%d секунд)...\n", filename, durationSeconds)
 
 	// Создаем WAV файл
 	out, err := os.Create(filename)
@@ -150,12 +175,11 @@ func (m *Metronome) GenerateWAV(filename string, durationSeconds int) error {
 	defer out.Close()
 
 	// Параметры аудио
-	totalSamples := sampleRate * durationSeconds
-	intervalSamples := int(float64(sampleRate) * 60.0 / float64(m.BPM))
+	totalSamples := int64(sampleRate * durationSeconds)
 
-	// Создаем буфер для аудиоданных
+	// Создаем буфер для аудиоданных (стерео, каналы чередуются)
 	buf := &goaudio.IntBuffer{
-		Data: make([]int, totalSamples),
+		Data: make([]int, totalSamples*2),
 		Format: &goaudio.Format{
 			SampleRate:  sampleRate,
 			NumChannels: 2,
@@ -163,21 +187,12 @@ func (m *Metronome) GenerateWAV(filename string, durationSeconds int) error {
 		SourceBitDepth: 16,
 	}
 
-	beatCount := 0
-	barCount := 1
-
-	for i := 0; i < totalSamples; i++ {
-		// Проверяем, нужно ли воспроизвести удар
-		if i%intervalSamples == 0 {
-			beatCount++
-			if beatCount > m.BeatsPerBar {
-				beatCount = 1
-				barCount++
-			}
-
-			soundType, volume := m.Pattern.GetSound(beatCount, barCount)
-			m.addSoundToBuffer(buf, i, intervalSamples, soundType, volume)
-		}
+	// Доли берем из того же секвенсора, что и живое воспроизведение
+	seq := m.newSequencer()
+	for !seq.finished() && seq.position() < totalSamples {
+		event := seq.next()
+		event.Pan = m.Pan
+		m.addSoundToBuffer(buf, event)
 	}
 
 	// Кодируем в WAV (используем псевдоним goaudiowav)
@@ -193,66 +208,26 @@ func (m *Metronome) GenerateWAV(filename string, durationSeconds int) error {
 	return nil
 }
 
-func (m *Metronome) addSoundToBuffer(buf *goaudio.IntBuffer, startIdx, durationSamples int, soundType string, volume float64) {
-	var freq float64
-	switch soundType {
-	case "accent":
-		freq = 880
-	case "ride":
-		freq = 1318.51
-	case "normal":
-		freq = 440
-	case "ghost":
-		freq = 220
-		volume *= 0.3
-	default:
-		freq = 440
-	}
-
-	// Длительность звука - 10% от интервала
-	soundSamples := durationSamples / 10
-
-	for i := 0; i < soundSamples && startIdx+i < len(buf.Data); i++ {
-		t := float64(i) / float64(buf.Format.SampleRate)
-		sample := math.Sin(2 * math.Pi * freq * t)
-
-		// ADSR огибающая
-		envelope := m.adsrEnvelope(i, soundSamples)
+// addSoundToBuffer подмешивает удар в буфер начиная с позиции event.sample
+func (m *Metronome) addSoundToBuffer(buf *goaudio.IntBuffer, event TickEvent) {
+	click := renderEvent(event)
+	left, right := panGains(event.Pan)
 
-		// Применяем volume и огибающую
-		sample *= volume * envelope
+	for i, sample := range click {
+		idx := (event.sample + int64(i)) * 2
+		if idx+1 >= int64(len(buf.Data)) {
+			break
+		}
 
 		// Конвертируем в 16-bit и добавляем в оба канала
-		val := int(sample * 32767)
-		idx := startIdx + i
-		if idx < len(buf.Data) {
-			buf.Data[idx] = val
-		}
+		buf.Data[idx] = clampSample(buf.Data[idx] + int(sample*left*32767))
+		buf.Data[idx+1] = clampSample(buf.Data[idx+1] + int(sample*right*32767))
 	}
 }
 
-// adsrEnvelope создает ADSR огибающую для метронома
-func (m *Metronome) adsrEnvelope(sample, totalSamples int) float64 {
-	attack := totalSamples / 10  // 10% attack
-	decay := totalSamples / 5    // 20% decay
-	release := totalSamples / 10 // 10% release
-	sustain := 0.7               // sustain level
-
-	if sample < attack {
-		// Attack фаза
-		return float64(sample) / float64(attack)
-	} else if sample < attack+decay {
-		// Decay фаза
-		decayPos := float64(sample-attack) / float64(decay)
-		return 1.0 - (1.0-sustain)*decayPos
-	} else if sample < totalSamples-release {
-		// Sustain фаза
-		return sustain
-	} else {
-		// Release фаза
-		releasePos := float64(sample-(totalSamples-release)) / float64(release)
-		return sustain * (1.0 - releasePos)
-	}
+// clampSample ограничивает значение диапазоном 16-bit
+func clampSample(val int) int {
+	return max(-32768, min(32767, val))
 }
 
 // Простая альтернатива без сложных зависимостей
@@ -280,8 +255,8 @@ func (m *Metronome) GenerateSimpleWAV(filename string, durationSeconds int) erro
 	defer out.Close()
 
 	// Записываем информацию о паттерне
-	content := fmt.Sprintf("Metronome Pattern\nBPM: %d\nTime Signature: %d/4\nPattern: %s\nDuration: %d seconds\n\n",
-		m.BPM, m.BeatsPerBar, m.Pattern.Name, durationSeconds)
+	content := fmt.Sprintf("Metronome Pattern\nBPM: %d\nTime Signature: %s\nPattern: %s\nDuration: %d seconds\n\n",
+		m.BPM, m.TimeSignature, m.Pattern.Name, durationSeconds)
 
 	_, err = out.WriteString(content)
 	return err
@@ -0,0 +1,162 @@
+package metronome
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - источник времени для планировщика метронома. Обычно это
+// RealClock, а в тестах - FakeClock, который двигается вручную.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer - таймер, созданный Clock
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// RealClock - системные часы
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+func (t *realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// FakeClock - часы, которые идут только при вызове Advance. Таймеры
+// срабатывают, когда время доходит до их срока, поэтому планировщик
+// можно проверять без реального ожидания.
+type FakeClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond // Сигнал о запуске и остановке таймеров
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+// NewFakeClock создает часы, показывающие время start
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+
+	c.mu.Lock()
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+
+	t.Reset(d)
+	return t
+}
+
+// Advance переводит часы вперед на d и запускает таймеры, чей срок наступил
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if t.active && !t.deadline.After(c.now) {
+			t.fire(c.now)
+		}
+	}
+}
+
+// BlockUntil ждет, пока взведенных таймеров станет ровно n. Планировщик
+// взводит таймер, закончив очередной проход, поэтому после BlockUntil(1)
+// все наступившие доли уже разосланы.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.active() != n {
+		c.changed.Wait()
+	}
+}
+
+// active считает взведенные таймеры. Вызывается под c.mu.
+func (c *FakeClock) active() int {
+	n := 0
+	for _, t := range c.timers {
+		if t.active {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	wasActive := t.active
+	t.deadline = t.clock.now.Add(d)
+	t.active = true
+	if d <= 0 {
+		t.fire(t.clock.now)
+	}
+	t.clock.changed.Broadcast()
+	return wasActive
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	wasActive := t.active
+	t.active = false
+	t.clock.changed.Broadcast()
+	return wasActive
+}
+
+// fire срабатывает таймер. Вызывается под clock.mu.
+func (t *fakeTimer) fire(now time.Time) {
+	t.active = false
+	t.clock.changed.Broadcast()
+	select {
+	case t.c <- now:
+	default:
+	}
+}
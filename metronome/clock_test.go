@@ -0,0 +1,63 @@
+package metronome
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockTimerFiresAtDeadline(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	timer := clock.NewTimer(time.Second)
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("таймер сработал раньше срока")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case now := <-timer.C():
+		if want := testStart.Add(time.Second); !now.Equal(want) {
+			t.Errorf("время срабатывания %v, ожидалось %v", now, want)
+		}
+	default:
+		t.Fatal("таймер не сработал в срок")
+	}
+}
+
+func TestFakeClockResetAndStop(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	timer := clock.NewTimer(time.Second)
+	clock.BlockUntil(1)
+
+	if !timer.Stop() {
+		t.Error("Stop взведенного таймера должен вернуть true")
+	}
+	clock.BlockUntil(0)
+	clock.Advance(2 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("остановленный таймер сработал")
+	default:
+	}
+
+	if timer.Reset(0) {
+		t.Error("Reset остановленного таймера должен вернуть false")
+	}
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("таймер с нулевым сроком должен сработать сразу")
+	}
+}
+
+func TestFakeClockNow(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	clock.Advance(1500 * time.Millisecond)
+
+	if got, want := clock.Now(), testStart.Add(1500*time.Millisecond); !got.Equal(want) {
+		t.Errorf("Now() = %v, ожидалось %v", got, want)
+	}
+}
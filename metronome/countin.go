@@ -0,0 +1,59 @@
+package metronome
+
+import "fmt"
+
+// MaxCountInBars - наибольшая длина отсчета в тактах
+const MaxCountInBars = 8
+
+// CountIn описывает отсчет перед первым тактом. Отсчет играется
+// отдельными звуками и не входит в счет тактов: первый такт после него -
+// такт 1.
+type CountIn struct {
+	Bars int // Количество тактов отсчета; 0 - без отсчета
+	// Вдвое реже во всех тактах, кроме последнего: "1 . 2 . 1 2 3 4"
+	HalfTime bool
+}
+
+// Validate проверяет настройки отсчета
+func (c CountIn) Validate() error {
+	if c.Bars < 0 || c.Bars > MaxCountInBars {
+		return fmt.Errorf("отсчет должен быть от 0 до %d тактов", MaxCountInBars)
+	}
+	return nil
+}
+
+// countInState ведет отсчет внутри секвенсора
+type countInState struct {
+	CountIn
+	bar  int // Такт отсчета (1-based)
+	beat int // Последняя выданная доля отсчета (0 - еще не начали)
+
+	ramp *TempoRamp // Переход темпа, который начнется после отсчета
+}
+
+func newCountInState(c CountIn) *countInState {
+	return &countInState{CountIn: c, bar: 1}
+}
+
+// next переходит к следующей доле отсчета в такте из beats долей.
+// Возвращает номер такта отсчета от конца (-2, -1), произносимый счет
+// (0 - доля пропускается) и признак последней доли отсчета.
+func (c *countInState) next(beats int) (bar, count int, last bool) {
+	c.beat++
+	if c.beat > beats {
+		c.beat = 1
+		c.bar++
+	}
+
+	count = c.beat
+	if c.HalfTime && c.bar < c.Bars {
+		// В половинном счете звучит только каждая вторая доля
+		if c.beat%2 == 0 {
+			count = 0
+		} else {
+			count = (c.beat + 1) / 2
+		}
+	}
+
+	return c.bar - c.Bars - 1, count, c.bar == c.Bars && c.beat == beats
+}
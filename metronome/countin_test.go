@@ -0,0 +1,152 @@
+package metronome
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// countInBeats выдает n событий секвенсора с отсчетом c
+func countInBeats(t *testing.T, m *Metronome, c CountIn, n int) []TickEvent {
+	t.Helper()
+
+	if err := m.SetCountIn(c); err != nil {
+		t.Fatalf("SetCountIn: %v", err)
+	}
+	seq := m.newSequencer()
+	events := make([]TickEvent, n)
+	for i := range events {
+		events[i] = seq.next()
+	}
+	return events
+}
+
+func TestCountInBars(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	got := countInBeats(t, m, CountIn{Bars: 2}, 10)
+
+	// Такты отсчета считаются от конца: -2, -1; за ними сразу такт 1
+	for i, e := range got[:8] {
+		bar, beat := i/4-2, i%4+1
+		sound := "count"
+		if beat == 1 {
+			sound = "count-accent"
+		}
+		if !e.CountIn || e.Bar != bar || e.Beat != beat || e.Count != beat || e.Sound != sound {
+			t.Errorf("доля отсчета %d: %+v", i+1, e)
+		}
+		if want := int64(i * 22050); e.sample != want {
+			t.Errorf("доля отсчета %d: семпл %d, ожидалось %d", i+1, e.sample, want)
+		}
+	}
+	for i, e := range got[8:] {
+		if e.CountIn || e.Bar != 1 || e.Beat != i+1 {
+			t.Errorf("после отсчета: такт %d доля %d, CountIn %v", e.Bar, e.Beat, e.CountIn)
+		}
+	}
+	if got[8].sample != 8*22050 || got[8].Sound != "accent" {
+		t.Errorf("первая доля после отсчета: семпл %d, звук %s", got[8].sample, got[8].Sound)
+	}
+}
+
+func TestCountInHalfTime(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	got := countInBeats(t, m, CountIn{Bars: 2, HalfTime: true}, 8)
+
+	// "1 . 2 . 1 2 3 4"
+	var counts []int
+	for _, e := range got {
+		counts = append(counts, e.Count)
+	}
+	if want := []int{1, 0, 2, 0, 1, 2, 3, 4}; !slices.Equal(counts, want) {
+		t.Errorf("счет %v, ожидалось %v", counts, want)
+	}
+	if got[1].Sound != "silent" || got[1].Audible() {
+		t.Errorf("пропущенная доля отсчета звучит: %+v", got[1])
+	}
+}
+
+func TestCountInKeepsBarCount(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetCountIn(CountIn{Bars: 1}); err != nil {
+		t.Fatalf("SetCountIn: %v", err)
+	}
+	bars := m.SubscribeEvents(context.Background(), OnlyKinds(KindBarStart))
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	// Весь отсчет позади, а счет тактов и долей не сдвинулся
+	collect(t, clock, events, 4)
+	if st := m.GetState(); st.Bar != 1 || st.Beat != 0 {
+		t.Errorf("после отсчета: такт %d, доля %d", st.Bar, st.Beat)
+	}
+	select {
+	case e := <-bars.Events():
+		t.Errorf("отсчет породил начало такта: %+v", e)
+	default:
+	}
+
+	e := collect(t, clock, events, 1)[0]
+	if e.CountIn || e.Bar != 1 || e.Beat != 1 {
+		t.Errorf("первая доля после отсчета: %+v", e)
+	}
+	if st := m.GetState(); st.Bar != 1 || st.Beat != 1 {
+		t.Errorf("на первой доле: такт %d, доля %d", st.Bar, st.Beat)
+	}
+}
+
+func TestCountInKeepsTrainer(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetTrainer(TrainerConfig{Start: 100, Step: 10, Interval: 1, Target: 200}); err != nil {
+		t.Fatalf("SetTrainer: %v", err)
+	}
+	got := countInBeats(t, m, CountIn{Bars: 2}, 16)
+
+	// Отсчет идет в начальном темпе, шаги начинаются с первого такта
+	for i, e := range got[:8] {
+		if e.Tempo != 100 {
+			t.Errorf("доля отсчета %d: темп %v", i+1, e.Tempo)
+		}
+	}
+	for _, e := range []TickEvent{got[8], got[12]} {
+		if want := 100 + 10*float64(e.Bar-1); e.Tempo != want {
+			t.Errorf("такт %d: темп %v, ожидалось %v", e.Bar, e.Tempo, want)
+		}
+	}
+	if s := got[8].Trainer; s == nil || s.Cycle != 1 || s.Tempo != 100 {
+		t.Errorf("тренажер на первом такте: %+v", s)
+	}
+}
+
+func TestCountInOutsideSessionLimit(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetSessionLimit(SessionLimit{Bars: 2}); err != nil {
+		t.Fatalf("SetSessionLimit: %v", err)
+	}
+	if err := m.SetCountIn(CountIn{Bars: 2}); err != nil {
+		t.Fatalf("SetCountIn: %v", err)
+	}
+
+	// Два такта отсчета и два такта занятия
+	got := playUntilStopped(t, m, clock)
+	if len(got) != 16 {
+		t.Fatalf("сыграно %d долей, ожидалось 16", len(got))
+	}
+	if last := got[len(got)-1]; last.Bar != 2 || last.Beat != 4 {
+		t.Errorf("последняя доля: такт %d доля %d, ожидалось 2/4", last.Bar, last.Beat)
+	}
+	if summary := m.Summary(); summary.Bars != 2 || summary.Beats != 8 || !summary.Finished {
+		t.Errorf("итоги %+v", summary)
+	}
+}
+
+func TestCountInValidate(t *testing.T) {
+	for _, bad := range []CountIn{{Bars: -1}, {Bars: MaxCountInBars + 1}} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) должен вернуть ошибку", bad)
+		}
+	}
+}
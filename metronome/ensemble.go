@@ -0,0 +1,154 @@
+package metronome
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errInEnsemble - метроном нельзя запускать и двигать отдельно, пока он
+// играет в ансамбле: у ансамбля один планировщик на всех
+var errInEnsemble = errors.New("метроном играет в ансамбле, управляйте ансамблем")
+
+// Ensemble играет несколько метрономов с независимыми темпами (политемп,
+// например 120 против 93 BPM). Все они планируются одним циклом от общего
+// начала временной шкалы и сводятся в один аудиопоток, так что их взаимное
+// расхождение определяется только темпами.
+type Ensemble struct {
+	Members []*Metronome
+	Running bool
+
+	mu       sync.Mutex
+	clock    Clock
+	out      *speakerOutput // Общий аудиовыход; nil - без звука
+	stopChan chan struct{}
+	solo     []soloSettings // Собственные настройки метрономов до Start
+}
+
+// soloSettings - то, что ансамбль меняет у метронома на время игры
+type soloSettings struct {
+	out   output
+	quiet bool
+}
+
+// NewEnsemble создает ансамбль из метрономов. Панорама каждого метронома
+// задается его полем Pan.
+func NewEnsemble(members ...*Metronome) (*Ensemble, error) {
+	if len(members) < 2 {
+		return nil, fmt.Errorf("для политемпа нужно хотя бы два метронома")
+	}
+	for i, m := range members {
+		if m.Pan < -1 || m.Pan > 1 {
+			return nil, fmt.Errorf("поток %d: панорама должна быть от -1 до 1", i+1)
+		}
+		if m.clock != members[0].clock {
+			return nil, fmt.Errorf("поток %d: метрономы ансамбля должны идти по одним часам", i+1)
+		}
+	}
+
+	return &Ensemble{
+		Members: members,
+		clock:   members[0].clock,
+		out:     &speakerOutput{},
+	}, nil
+}
+
+// Start запускает все метрономы на общей временной шкале. Пока ансамбль
+// играет, метрономы управляются только через него: их собственные Play,
+// Pause, Resume и Seek возвращают ошибку.
+func (e *Ensemble) Start() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.Running {
+		return fmt.Errorf("ансамбль уже запущен")
+	}
+
+	for _, m := range e.Members {
+		m.mu.Lock()
+		running, other := m.Running, m.ensemble
+		m.mu.Unlock()
+		if running {
+			return fmt.Errorf("метроном ансамбля уже запущен отдельно")
+		}
+		if other != nil {
+			return fmt.Errorf("метроном уже играет в другом ансамбле")
+		}
+	}
+
+	var lane output
+	if e.out != nil {
+		if err := e.out.Start(0); err != nil {
+			first := e.Members[0]
+			first.mu.Lock()
+			progress := first.progress
+			first.mu.Unlock()
+			fmt.Fprintf(progress, "Аудио недоступно: %v\n", err)
+		} else {
+			lane = &laneOutput{shared: e.out}
+		}
+	}
+
+	start := e.clock.Now()
+	e.solo = make([]soloSettings, len(e.Members))
+	for i, m := range e.Members {
+		m.mu.Lock()
+		e.solo[i] = soloSettings{out: m.out, quiet: m.quiet}
+		m.out = lane
+		m.quiet = true
+		m.ensemble = e
+		m.begin(start)
+		m.mu.Unlock()
+		m.flush()
+	}
+
+	e.Running = true
+	e.stopChan = make(chan struct{})
+	go e.run()
+
+	return nil
+}
+
+// run - общий цикл планировщика для всех метрономов ансамбля
+func (e *Ensemble) run() {
+	timer := e.clock.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+			wait := schedulerInterval
+			for _, m := range e.Members {
+				wait = min(wait, m.schedule())
+			}
+			timer.Reset(wait)
+		case <-e.stopChan:
+			return
+		}
+	}
+}
+
+// Stop останавливает все метрономы и общий поток
+func (e *Ensemble) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.Running {
+		return
+	}
+
+	e.Running = false
+	close(e.stopChan)
+	for i, m := range e.Members {
+		m.Stop()
+		m.mu.Lock()
+		m.ensemble = nil
+		m.out = e.solo[i].out
+		m.quiet = e.solo[i].quiet
+		m.mu.Unlock()
+	}
+	e.solo = nil
+	if e.out != nil {
+		e.out.Stop()
+	}
+}
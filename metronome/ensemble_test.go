@@ -0,0 +1,128 @@
+package metronome
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestEnsembleMembersRejectTransport(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var members []*Metronome
+	for _, bpm := range []int{120, 90} {
+		m, err := NewMetronomeWithClock(bpm, 4, PredefinedPatterns()["basic"], clock)
+		if err != nil {
+			t.Fatalf("NewMetronomeWithClock: %v", err)
+		}
+		m.out = nil
+		m.quiet = true
+		members = append(members, m)
+	}
+	e, err := NewEnsemble(members...)
+	if err != nil {
+		t.Fatalf("NewEnsemble: %v", err)
+	}
+	e.out = nil
+
+	m := members[0]
+	beats := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+	if err := e.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	collect(t, clock, beats.Events(), 2)
+
+	for name, call := range map[string]func() error{
+		"Play":   m.Play,
+		"Pause":  m.Pause,
+		"Resume": m.Resume,
+		"Seek":   func() error { return m.Seek(3, 1) },
+	} {
+		if err := call(); !errors.Is(err, errInEnsemble) {
+			t.Errorf("%s у метронома ансамбля: %v", name, err)
+		}
+	}
+	if m.Transport() != TransportPlaying {
+		t.Errorf("метроном ансамбля в состоянии %s", m.Transport())
+	}
+
+	// Планировщик по-прежнему один: collect ждет ровно один таймер
+	got := collect(t, clock, beats.Events(), 2)
+	if b := got[0].(BeatEvent); b.Bar != 1 || b.Beat != 3 {
+		t.Errorf("после отклоненных вызовов: такт %d, доля %d", b.Bar, b.Beat)
+	}
+
+	// После остановки ансамбля метроном снова свой
+	e.Stop()
+	if err := m.Play(); err != nil {
+		t.Errorf("Play после остановки ансамбля: %v", err)
+	}
+	m.Stop()
+}
+
+// recordOutput запоминает поставленные в поток удары
+type recordOutput struct {
+	mu     sync.Mutex
+	events []TickEvent
+}
+
+func (o *recordOutput) Start(origin int64) error { return nil }
+func (o *recordOutput) Stop()                    {}
+
+func (o *recordOutput) Schedule(event TickEvent) {
+	o.mu.Lock()
+	o.events = append(o.events, event)
+	o.mu.Unlock()
+}
+
+func (o *recordOutput) count() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.events)
+}
+
+func TestEnsembleRestoresMemberOutput(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	var members []*Metronome
+	for _, bpm := range []int{120, 90} {
+		m, err := NewMetronomeWithClock(bpm, 4, PredefinedPatterns()["basic"], clock)
+		if err != nil {
+			t.Fatalf("NewMetronomeWithClock: %v", err)
+		}
+		members = append(members, m)
+	}
+	solo := &recordOutput{}
+	m := members[0]
+	m.out = solo
+	m.SetProgressWriter(io.Discard)
+
+	e, err := NewEnsemble(members...)
+	if err != nil {
+		t.Fatalf("NewEnsemble: %v", err)
+	}
+	e.out = nil
+	if err := e.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	beats := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+	collect(t, clock, beats.Events(), 2)
+	e.Stop()
+
+	if m.out != solo || m.quiet {
+		t.Fatalf("после ансамбля: выход %T, quiet %v", m.out, m.quiet)
+	}
+	if solo.count() != 0 {
+		t.Errorf("в собственный выход попало %d ударов во время ансамбля", solo.count())
+	}
+
+	// Сам по себе метроном снова звучит через свой выход
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+	collect(t, clock, beats.Events(), 1)
+	if solo.count() == 0 {
+		t.Error("метроном после ансамбля не ставит удары в свой выход")
+	}
+}
@@ -0,0 +1,141 @@
+package metronome
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Euclid возвращает евклидов ритм E(k, n): k ударов, распределенных по n
+// шагам как можно равномернее, сдвинутый на rotate шагов влево.
+// E(3, 8) = x..x..x.
+func Euclid(k, n, rotate int) ([]bool, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("число шагов должно быть положительным")
+	}
+	if k < 0 || k > n {
+		return nil, fmt.Errorf("число ударов должно быть от 0 до %d", n)
+	}
+
+	rotate = ((rotate % n) + n) % n
+	steps := make([]bool, n)
+	for i := range steps {
+		j := (i + rotate) % n
+		steps[i] = j*k%n < k
+	}
+	return steps, nil
+}
+
+// StepMask записывает шаги маской: x - удар, . - пауза
+func StepMask(steps []bool) string {
+	var sb strings.Builder
+	for _, hit := range steps {
+		if hit {
+			sb.WriteByte('x')
+		} else {
+			sb.WriteByte('.')
+		}
+	}
+	return sb.String()
+}
+
+// EuclidLayer - параметры одного голоса евклидова паттерна
+type EuclidLayer struct {
+	Hits   int     // Ударов (k)
+	Steps  int     // Шагов за такт (n)
+	Rotate int     // Сдвиг влево в шагах
+	Sound  string  // Тип звука
+	Volume float64 // Громкость (0.0-1.0)
+}
+
+// ParseEuclidLayer разбирает голос в записи "k,n[,rotate][:sound]",
+// например "5,16:rim" или "3,8,1:cowbell"
+func ParseEuclidLayer(s string) (EuclidLayer, error) {
+	spec, sound, _ := strings.Cut(s, ":")
+	parts := strings.Split(spec, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return EuclidLayer{}, fmt.Errorf("голос должен быть вида \"k,n[,сдвиг][:звук]\", получено '%s'", s)
+	}
+
+	nums := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return EuclidLayer{}, fmt.Errorf("голос '%s': неверное число '%s'", s, part)
+		}
+		nums[i] = n
+	}
+
+	layer := EuclidLayer{Hits: nums[0], Steps: nums[1], Rotate: nums[2], Sound: sound, Volume: 0.8}
+	if _, err := Euclid(layer.Hits, layer.Steps, layer.Rotate); err != nil {
+		return EuclidLayer{}, fmt.Errorf("голос '%s': %w", s, err)
+	}
+	return layer, nil
+}
+
+func (l EuclidLayer) String() string {
+	return fmt.Sprintf("E(%d,%d)", l.Hits, l.Steps)
+}
+
+// NewEuclidPattern строит паттерн из евклидовых ритмов. Первый голос
+// задает доли такта: n шагов длительностью unit (8 - восьмые), удары
+// звучат, паузы молчат. Остальные голоса ложатся поверх слоями, каждый
+// своими шагами на весь такт - например, E(3,8) на ковбелле поверх
+// E(5,16) на римшоте.
+func NewEuclidPattern(name string, unit int, main EuclidLayer, layers ...EuclidLayer) (*Pattern, error) {
+	steps, err := Euclid(main.Hits, main.Steps, main.Rotate)
+	if err != nil {
+		return nil, err
+	}
+	meter := TimeSignature{Numerator: main.Steps, Denominator: unit}
+	if err := meter.Validate(); err != nil {
+		return nil, err
+	}
+
+	descr := []string{fmt.Sprintf("%s %s", main, StepMask(steps))}
+	pattern := &Pattern{
+		Name:   name,
+		Beats:  main.Steps,
+		Meter:  meter.String(),
+		Cycle:  1,
+		Layers: make([]Layer, 0, len(layers)),
+	}
+
+	for i, hit := range steps {
+		def := BeatDefinition{Beat: i + 1, Sound: "silent", Volume: 0}
+		if hit {
+			def.Sound, def.Volume = main.Sound, main.Volume
+			if def.Sound == "" {
+				def.Sound = "normal"
+			}
+			// Первый удар такта выделяем, чтобы было слышно начало цикла
+			if i == 0 {
+				def.Accent = true
+				def.Volume = min(def.Volume+0.2, 1)
+			}
+		}
+		pattern.Pattern = append(pattern.Pattern, def)
+	}
+
+	for _, layer := range layers {
+		mask, err := Euclid(layer.Hits, layer.Steps, layer.Rotate)
+		if err != nil {
+			return nil, fmt.Errorf("голос %s: %w", layer, err)
+		}
+		sound := layer.Sound
+		if sound == "" {
+			sound = "accent"
+		}
+		pattern.Layers = append(pattern.Layers, Layer{
+			Name:   layer.String(),
+			Pulses: layer.Steps,
+			Steps:  StepMask(mask),
+			Sound:  sound,
+			Volume: layer.Volume,
+		})
+		descr = append(descr, fmt.Sprintf("%s %s", layer, StepMask(mask)))
+	}
+
+	pattern.Description = "Евклидов ритм " + strings.Join(descr, " + ")
+	return pattern, nil
+}
@@ -0,0 +1,66 @@
+package metronome
+
+import "testing"
+
+func TestEuclid(t *testing.T) {
+	tests := []struct {
+		k, n, rotate int
+		want         string
+	}{
+		{3, 8, 0, "x..x..x."},
+		{5, 8, 0, "x.x.xx.x"},
+		{5, 8, 2, "x.xx.xx."},
+		{4, 16, 0, "x...x...x...x..."},
+		{0, 4, 0, "...."},
+		{3, 8, -1, ".x..x..x"},
+	}
+	for _, tt := range tests {
+		steps, err := Euclid(tt.k, tt.n, tt.rotate)
+		if err != nil {
+			t.Fatalf("Euclid(%d,%d,%d): %v", tt.k, tt.n, tt.rotate, err)
+		}
+		if got := StepMask(steps); got != tt.want {
+			t.Errorf("Euclid(%d,%d,%d) = %s, ожидалось %s", tt.k, tt.n, tt.rotate, got, tt.want)
+		}
+	}
+
+	if _, err := Euclid(9, 8, 0); err == nil {
+		t.Error("ударов больше, чем шагов - должна быть ошибка")
+	}
+}
+
+func TestEuclidPatternLayers(t *testing.T) {
+	rim, err := ParseEuclidLayer("5,16:rim")
+	if err != nil {
+		t.Fatalf("ParseEuclidLayer: %v", err)
+	}
+	pat, err := NewEuclidPattern("cow", 8, EuclidLayer{Hits: 3, Steps: 8, Sound: "cowbell", Volume: 0.8}, rim)
+	if err != nil {
+		t.Fatalf("NewEuclidPattern: %v", err)
+	}
+
+	if pat.TimeSignature() != (TimeSignature{8, 8}) {
+		t.Errorf("размер %s, ожидалось 8/8", pat.TimeSignature())
+	}
+	var mask []bool
+	for beat := 1; beat <= 8; beat++ {
+		mask = append(mask, pat.Lookup(beat, 1).Sound == "cowbell")
+	}
+	if got := StepMask(mask); got != "x..x..x." {
+		t.Errorf("основной голос %s, ожидалось x..x..x.", got)
+	}
+
+	// Считаем удары слоя за такт
+	hits := 0
+	for pulse := 0; pulse < 8; pulse++ {
+		for _, lh := range layerHitsInPulse(pat.Layers, 8, pulse, 1000) {
+			if lh.hit.Sound != "rim" {
+				t.Errorf("звук слоя %q", lh.hit.Sound)
+			}
+			hits++
+		}
+	}
+	if hits != 5 {
+		t.Errorf("слой E(5,16) дал %d ударов за такт", hits)
+	}
+}
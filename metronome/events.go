@@ -0,0 +1,370 @@
+package metronome
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventKind - тип события шины метронома
+type EventKind int
+
+const (
+	KindBeat           EventKind = iota // Прозвучал удар (BeatEvent)
+	KindBarStart                        // Начался такт (BarStart)
+	KindTempoChanged                    // Сменился темп (TempoChanged)
+	KindPatternChanged                  // Сменился паттерн (PatternChanged)
+	KindStarted                         // Воспроизведение началось (Started)
+	KindStopped                         // Воспроизведение остановлено (Stopped)
+	KindModulated                       // Метрическая модуляция (Modulated)
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case KindBeat:
+		return "beat"
+	case KindBarStart:
+		return "bar_start"
+	case KindTempoChanged:
+		return "tempo_changed"
+	case KindPatternChanged:
+		return "pattern_changed"
+	case KindStarted:
+		return "started"
+	case KindStopped:
+		return "stopped"
+	case KindModulated:
+		return "modulated"
+	default:
+		return "unknown"
+	}
+}
+
+// Event - событие шины метронома. Конкретный тип определяется Kind:
+// BeatEvent, BarStart, TempoChanged, PatternChanged, Started, Stopped
+// или Modulated.
+type Event interface {
+	Kind() EventKind
+	Time() time.Time
+}
+
+// BeatEvent - удар: доля, подразделение, удар слоя или доля отсчета
+type BeatEvent struct {
+	TickEvent
+}
+
+// BarStart - первая доля такта. Такты отсчета его не порождают.
+type BarStart struct {
+	Bar           int
+	TimeSignature TimeSignature
+	Section       string // Раздел песни; пусто вне режима песни
+	Timestamp     time.Time
+}
+
+// TempoChanged - темп доли отличается от темпа предыдущей. Во время
+// плавного перехода приходит на каждой доле.
+type TempoChanged struct {
+	From, To  float64
+	Jump      bool // Смена скачком, а не плавный переход
+	Bar, Beat int
+	Timestamp time.Time
+}
+
+// PatternChanged - доля сыграна по другому паттерну, чем предыдущая
+type PatternChanged struct {
+	Pattern   string
+	Bar       int
+	Timestamp time.Time
+}
+
+// Started - воспроизведение началось или продолжилось после паузы
+type Started struct {
+	Resumed   bool // Продолжение после паузы
+	Bar, Beat int  // Позиция, с которой идет игра
+	Timestamp time.Time
+}
+
+// Stopped - воспроизведение остановлено или поставлено на паузу
+type Stopped struct {
+	Paused    bool // Пауза: Resume продолжит с того же места
+	Finished  bool // Песня доиграна до конца
+	Timestamp time.Time
+}
+
+// Modulated - с этого такта действует метрическая модуляция. Вслед за
+// ним приходит и TempoChanged.
+type Modulated struct {
+	Modulation MetricModulation
+	From, To   float64
+	Bar        int
+	Timestamp  time.Time
+}
+
+func (e BeatEvent) Kind() EventKind      { return KindBeat }
+func (e BarStart) Kind() EventKind       { return KindBarStart }
+func (e TempoChanged) Kind() EventKind   { return KindTempoChanged }
+func (e PatternChanged) Kind() EventKind { return KindPatternChanged }
+func (e Started) Kind() EventKind        { return KindStarted }
+func (e Stopped) Kind() EventKind        { return KindStopped }
+func (e Modulated) Kind() EventKind      { return KindModulated }
+
+func (e BeatEvent) Time() time.Time      { return e.Timestamp }
+func (e BarStart) Time() time.Time       { return e.Timestamp }
+func (e TempoChanged) Time() time.Time   { return e.Timestamp }
+func (e PatternChanged) Time() time.Time { return e.Timestamp }
+func (e Started) Time() time.Time        { return e.Timestamp }
+func (e Stopped) Time() time.Time        { return e.Timestamp }
+func (e Modulated) Time() time.Time      { return e.Timestamp }
+
+// EventFilter отбирает события для подписки
+type EventFilter func(Event) bool
+
+// OnlyKinds пропускает только события перечисленных типов
+func OnlyKinds(kinds ...EventKind) EventFilter {
+	return func(e Event) bool {
+		for _, kind := range kinds {
+			if e.Kind() == kind {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// eventBufferSize - размер буфера канала подписки
+const eventBufferSize = 100
+
+// Subscription - подписка на шину событий метронома. Если подписчик не
+// успевает читать и буфер полон, события отбрасываются и учитываются
+// в Dropped; метроном при этом никогда не ждет подписчика.
+type Subscription struct {
+	ch      chan Event
+	filters []EventFilter
+	dropped atomic.Uint64
+	bus     *eventBus
+	mu      sync.Mutex // Не дает закрыть канал во время отправки
+	closed  chan struct{}
+}
+
+// Events возвращает канал событий. Он закрывается при отписке.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped возвращает количество событий, отброшенных из-за полного буфера
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe отписывается от шины. Повторный вызов ничего не делает.
+func (s *Subscription) Unsubscribe() {
+	s.bus.unsubscribe(s)
+}
+
+// send доставляет событие, если подписка еще не закрыта. Полный буфер
+// событие отбрасывает.
+func (s *Subscription) send(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	select {
+	case s.ch <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// close закрывает канал подписки
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	close(s.closed)
+	close(s.ch)
+}
+
+// accepts проверяет событие фильтрами подписки
+func (s *Subscription) accepts(e Event) bool {
+	for _, filter := range s.filters {
+		if !filter(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// eventBus рассылает события подписчикам. У шины своя блокировка,
+// поэтому подписка и отписка не зависят от состояния метронома.
+type eventBus struct {
+	mu   sync.Mutex
+	subs []*Subscription
+}
+
+func (b *eventBus) subscribe(ctx context.Context, filters []EventFilter) *Subscription {
+	sub := &Subscription{
+		ch:      make(chan Event, eventBufferSize),
+		filters: filters,
+		bus:     b,
+		closed:  make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subs = append(b.subs, sub)
+	b.mu.Unlock()
+
+	// Подписка живет, пока не отменен контекст
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				b.unsubscribe(sub)
+			case <-sub.closed:
+			}
+		}()
+	}
+
+	return sub
+}
+
+func (b *eventBus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	i := slices.Index(b.subs, sub)
+	if i >= 0 {
+		b.subs = slices.Delete(slices.Clone(b.subs), i, i+1)
+	}
+	b.mu.Unlock()
+
+	if i >= 0 {
+		sub.close()
+	}
+}
+
+// publish рассылает события подписчикам. Фильтры - пользовательский код,
+// поэтому они вызываются без блокировки шины: из фильтра можно
+// подписываться и отписываться.
+func (b *eventBus) publish(events ...Event) {
+	b.mu.Lock()
+	subs := b.subs
+	b.mu.Unlock()
+
+	for _, e := range events {
+		for _, sub := range subs {
+			if sub.accepts(e) {
+				sub.send(e)
+			}
+		}
+	}
+}
+
+// emit ставит события в очередь рассылки. Вызывается под m.mu; очередь
+// рассылается через flush после снятия блокировки.
+func (m *Metronome) emit(events ...Event) {
+	m.outbox = append(m.outbox, events...)
+}
+
+// flush рассылает очередь событий без m.mu: фильтры подписчиков могут
+// обращаться к метроному. Рассылает одна горутина за раз, так что порядок
+// событий сохраняется; если рассылка уже идет, очередь дошлет она.
+func (m *Metronome) flush() {
+	for m.publishing.TryLock() {
+		m.mu.Lock()
+		events := m.outbox
+		m.outbox = nil
+		m.mu.Unlock()
+
+		m.bus.publish(events...)
+		m.publishing.Unlock()
+
+		// События, поставленные во время рассылки, могли не дождаться ее
+		m.mu.Lock()
+		more := len(m.outbox) > 0
+		m.mu.Unlock()
+		if !more {
+			return
+		}
+	}
+}
+
+// SubscribeEvents подписывается на типизированные события метронома.
+// Событие доставляется, если его пропускают все фильтры. Подписка
+// завершается при отмене ctx или вызове Unsubscribe; подписываться и
+// отписываться можно в любой момент, не останавливая метроном.
+func (m *Metronome) SubscribeEvents(ctx context.Context, filters ...EventFilter) *Subscription {
+	return m.bus.subscribe(ctx, filters)
+}
+
+// Unsubscribe отписывает sub от событий метронома
+func (m *Metronome) Unsubscribe(sub *Subscription) {
+	sub.Unsubscribe()
+}
+
+// track обновляет счетчики по наступившей доле и возвращает порожденные
+// ею события шины. Вызывается под m.mu.
+func (m *Metronome) track(event TickEvent) []Event {
+	var events []Event
+	m.stats.count(event)
+
+	if !event.CountIn {
+		// Отсчет не входит в счет долей и тактов
+		m.beatCount = event.Beat
+		m.barCount = event.Bar
+
+		if event.Beat == 1 && event.SubBeat == 0 && !event.LayerOnly {
+			events = append(events, BarStart{
+				Bar:           event.Bar,
+				TimeSignature: event.TimeSignature,
+				Section:       event.Section,
+				Timestamp:     event.Timestamp,
+			})
+		}
+	}
+
+	if event.Modulation != nil {
+		events = append(events, Modulated{
+			Modulation: *event.Modulation,
+			From:       m.tempo,
+			To:         event.Tempo,
+			Bar:        event.Bar,
+			Timestamp:  event.Timestamp,
+		})
+		// Дальнейшие SetBPM и горячие клавиши считают от нового темпа
+		if m.song == nil {
+			m.BPM = int(math.Round(event.Tempo))
+		}
+	}
+	if event.Tempo != m.tempo {
+		events = append(events, TempoChanged{
+			From:      m.tempo,
+			To:        event.Tempo,
+			Jump:      event.TempoChanged,
+			Bar:       event.Bar,
+			Beat:      event.Beat,
+			Timestamp: event.Timestamp,
+		})
+	}
+	if event.pattern != m.lastPattern && event.pattern != nil {
+		events = append(events, PatternChanged{
+			Pattern:   event.pattern.Name,
+			Bar:       event.Bar,
+			Timestamp: event.Timestamp,
+		})
+	}
+
+	m.tempo = event.Tempo
+	m.lastPattern = event.pattern
+	m.trainerStatus = event.Trainer
+	m.BeatsPerBar = event.BeatsPerBar
+	m.TimeSignature = event.TimeSignature
+	m.Pattern = event.pattern
+	m.section = event.Section
+
+	return append(events, BeatEvent{TickEvent: event})
+}
@@ -0,0 +1,218 @@
+package metronome
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventBusSequence(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	sub := m.SubscribeEvents(context.Background(), OnlyKinds(
+		KindBarStart, KindTempoChanged, KindStarted, KindStopped))
+	beats := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	collect(t, clock, beats.Events(), 3)
+	if err := m.SetBPM(60); err != nil {
+		t.Fatalf("SetBPM: %v", err)
+	}
+	collect(t, clock, beats.Events(), 2)
+	m.Stop()
+
+	got := collect(t, clock, sub.Events(), 5)
+	kinds := make([]EventKind, len(got))
+	for i, e := range got {
+		kinds[i] = e.Kind()
+	}
+	want := []EventKind{KindStarted, KindBarStart, KindTempoChanged, KindBarStart, KindStopped}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("типы событий %v, ожидались %v", kinds, want)
+		}
+	}
+
+	change := got[2].(TempoChanged)
+	if change.From != 120 || change.To != 60 || !change.Jump || change.Bar != 1 || change.Beat != 4 {
+		t.Errorf("смена темпа: %+v", change)
+	}
+	if bar := got[3].(BarStart); bar.Bar != 2 || !bar.Timestamp.Equal(testStart.Add(2500*time.Millisecond)) {
+		t.Errorf("начало такта: %+v", bar)
+	}
+	if stopped := got[4].(Stopped); stopped.Paused || stopped.Finished {
+		t.Errorf("остановка: %+v", stopped)
+	}
+}
+
+func TestEventBusPatternChanged(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	sub := m.SubscribeEvents(context.Background(), OnlyKinds(KindPatternChanged))
+	beats := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	collect(t, clock, beats.Events(), 1)
+	m.SetPattern(PredefinedPatterns()["rock"])
+
+	got := collect(t, clock, sub.Events(), 1)
+	if change := got[0].(PatternChanged); change.Pattern != "rock" {
+		t.Errorf("смена паттерна: %+v", change)
+	}
+}
+
+func TestEventBusPauseResume(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	sub := m.SubscribeEvents(context.Background(), OnlyKinds(KindStarted, KindStopped))
+	beats := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+
+	m.Play()
+	defer m.Stop()
+	collect(t, clock, beats.Events(), 2)
+	m.Pause()
+	m.Resume()
+
+	got := collect(t, clock, sub.Events(), 3)
+	if s, ok := got[1].(Stopped); !ok || !s.Paused {
+		t.Errorf("ожидалась пауза, получено %+v", got[1])
+	}
+	if s, ok := got[2].(Started); !ok || !s.Resumed || s.Bar != 1 || s.Beat != 2 {
+		t.Errorf("ожидалось продолжение с такта 1 доли 2, получено %+v", got[2])
+	}
+}
+
+func TestUnsubscribeWithContext(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := m.SubscribeEvents(ctx)
+	other := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+
+	m.Play()
+	defer m.Stop()
+	collect(t, clock, other.Events(), 1)
+
+	cancel()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-sub.Events():
+			if !ok {
+				// Метроном продолжает играть для остальных подписчиков
+				collect(t, clock, other.Events(), 2)
+				return
+			}
+		case <-timeout:
+			t.Fatal("канал подписки не закрыт после отмены контекста")
+		}
+	}
+}
+
+func TestUnsubscribeTwice(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	sub := m.SubscribeEvents(context.Background())
+
+	m.Unsubscribe(sub)
+	sub.Unsubscribe()
+
+	if _, ok := <-sub.Events(); ok {
+		t.Error("канал подписки открыт после Unsubscribe")
+	}
+}
+
+func TestDroppedEvents(t *testing.T) {
+	m, clock := newTestMetronome(t, 300, 4, "basic")
+	slow := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+	beats := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+
+	m.Play()
+	defer m.Stop()
+
+	// Второй подписчик читает, первый - нет
+	n := eventBufferSize + 10
+	collect(t, clock, beats.Events(), n)
+
+	if got := slow.Dropped(); got != 10 {
+		t.Errorf("Dropped() = %d, ожидалось 10", got)
+	}
+	if got := beats.Dropped(); got != 0 {
+		t.Errorf("у читающего подписчика Dropped() = %d", got)
+	}
+}
+
+func TestFilterMayUnsubscribe(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+
+	// Фильтр отписывает свою подписку и подписывает новую прямо во
+	// время рассылки
+	var sub, added *Subscription
+	sub = m.SubscribeEvents(context.Background(), func(e Event) bool {
+		if added == nil {
+			added = m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+			sub.Unsubscribe()
+		}
+		return true
+	})
+	beats := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+
+	m.Play()
+	defer m.Stop()
+	collect(t, clock, beats.Events(), 4)
+
+	for range sub.Events() {
+		// Дочитываем события, доставленные до отписки
+	}
+	// Подписка из фильтра получает события
+	collect(t, clock, added.Events(), 2)
+}
+
+func TestFilterMayQueryMetronome(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+
+	// Фильтр обращается к метроному: события транспорта рассылаются
+	// без его блокировки
+	var mu sync.Mutex
+	var states []TransportState
+	transport := OnlyKinds(KindStarted, KindStopped)
+	sub := m.SubscribeEvents(context.Background(), func(e Event) bool {
+		if !transport(e) {
+			return false
+		}
+		mu.Lock()
+		states = append(states, m.Transport())
+		mu.Unlock()
+		m.Summary()
+		return true
+	})
+	beats := m.SubscribeEvents(context.Background(), OnlyKinds(KindBeat))
+
+	m.Play()
+	collect(t, clock, beats.Events(), 2)
+	m.Pause()
+	m.Resume()
+	m.Stop()
+
+	want := []EventKind{KindStarted, KindStopped, KindStarted, KindStopped}
+	for i, kind := range want {
+		select {
+		case e := <-sub.Events():
+			if e.Kind() != kind {
+				t.Errorf("событие %d: %v, ожидалось %v", i, e.Kind(), kind)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("событие %d не пришло", i)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	wantStates := []TransportState{TransportPlaying, TransportPaused, TransportPlaying, TransportStopped}
+	if !slices.Equal(states, wantStates) {
+		t.Errorf("состояния в фильтре: %v, ожидалось %v", states, wantStates)
+	}
+}
@@ -0,0 +1,102 @@
+package metronome
+
+import "fmt"
+
+// Fill - сбивка: каждый Every-й такт основной паттерн заменяется паттерном
+// сбивки, а сильная доля после нее может звучать тарелкой
+type Fill struct {
+	Pattern string `json:"pattern"`         // Название паттерна сбивки
+	Every   int    `json:"every,omitempty"` // Каждый какой такт - сбивка; 0 - последний такт цикла
+	Crash   bool   `json:"crash,omitempty"` // Тарелка на первой доле после сбивки
+
+	pattern *Pattern
+}
+
+// Validate проверяет настройки сбивки
+func (f Fill) Validate() error {
+	if f.Pattern == "" {
+		return fmt.Errorf("не указан паттерн сбивки")
+	}
+	if f.Every < 0 || f.Every == 1 {
+		return fmt.Errorf("сбивка должна повторяться не чаще раза в два такта")
+	}
+	return nil
+}
+
+// Resolve проверяет сбивку и находит ее паттерн через lookup. Сбивки
+// самого паттерна сбивки не играются.
+func (f *Fill) Resolve(lookup func(name string) (*Pattern, error)) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	pattern, err := lookup(f.Pattern)
+	if err != nil {
+		return fmt.Errorf("сбивка: %w", err)
+	}
+	f.pattern = pattern
+	return nil
+}
+
+// every возвращает период сбивки для основного паттерна main: без Every
+// сбивка занимает последний такт его цикла. 0 - сбивки нет.
+func (f *Fill) every(main *Pattern) int {
+	if f.Every > 0 {
+		return f.Every
+	}
+	if cycle := main.CycleLength(); cycle > 1 {
+		return cycle
+	}
+	return 0
+}
+
+// Resolve находит паттерн сбивки паттерна, если она задана
+func (p *Pattern) Resolve(lookup func(name string) (*Pattern, error)) error {
+	if p.Fill == nil {
+		return nil
+	}
+	if p.Fill.Every == 0 && p.CycleLength() < 2 {
+		return fmt.Errorf("паттерн %s: у сбивки не задан период, а цикла у паттерна нет", p.Name)
+	}
+	if err := p.Fill.Resolve(lookup); err != nil {
+		return fmt.Errorf("паттерн %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// fillState отслеживает сбивки внутри секвенсора
+type fillState struct {
+	fill  *Fill // Сбивка текущего такта; nil - играет основной паттерн
+	count int   // Номер сбивки от начала паттерна, для ее собственного цикла
+	crash bool  // Текущий такт начинается тарелкой после сбивки
+}
+
+// onBar решает на первой доле такта bar паттерна main, играет ли в нем
+// сбивка fill
+func (s *fillState) onBar(fill *Fill, main *Pattern, bar int) {
+	s.crash = s.fill != nil && s.fill.Crash
+	s.fill = nil
+	if fill == nil || fill.pattern == nil {
+		return
+	}
+	if every := fill.every(main); every > 0 && bar%every == 0 {
+		s.fill = fill
+		s.count = bar / every
+	}
+}
+
+// SetFill задает сбивку поверх паттерна и песни. Сбивка должна быть
+// разрешена через Resolve. Действует со следующего запуска.
+func (m *Metronome) SetFill(f Fill) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if f.pattern == nil {
+		return fmt.Errorf("паттерн сбивки '%s' не найден", f.Pattern)
+	}
+
+	m.mu.Lock()
+	m.fill = &f
+	m.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package metronome
+
+import "testing"
+
+func TestFillEveryNthBar(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	fill := Fill{Pattern: "rock-fill", Every: 4, Crash: true}
+	if err := fill.Resolve(testLookup); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if err := m.SetFill(fill); err != nil {
+		t.Fatalf("SetFill: %v", err)
+	}
+
+	seq := m.newSequencer()
+	for bar := 1; bar <= 9; bar++ {
+		for beat := 1; beat <= 4; {
+			e := seq.next()
+			if e.SubBeat > 0 {
+				continue
+			}
+			if e.Fill != (bar%4 == 0) {
+				t.Errorf("такт %d: сбивка %v", bar, e.Fill)
+			}
+			if crash := bar == 5 || bar == 9; beat == 1 && (e.Sound == "crash") != crash {
+				t.Errorf("такт %d: первая доля %q, тарелка ожидалась: %v", bar, e.Sound, crash)
+			}
+			if e.Fill && e.Subdivision < 2 {
+				t.Errorf("такт %d, доля %d сбивки не подразделена", bar, beat)
+			}
+			beat++
+		}
+	}
+}
+
+func TestPatternFillOnCycle(t *testing.T) {
+	pat := *PredefinedPatterns()["shuffle"]
+	pat.Fill = &Fill{Pattern: "rock"}
+	if err := pat.Resolve(testLookup); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	m.Pattern = &pat
+	seq := m.newSequencer()
+	for bar := 1; bar <= 4; bar++ {
+		e := seq.next()
+		// Без периода сбивка занимает последний такт цикла из двух
+		if e.Fill != (bar%2 == 0) {
+			t.Errorf("такт %d: сбивка %v", bar, e.Fill)
+		}
+		for range 3 {
+			seq.next()
+		}
+	}
+
+	basic := *PredefinedPatterns()["basic"]
+	basic.Fill = &Fill{Pattern: "rock"}
+	if err := basic.Resolve(testLookup); err == nil {
+		t.Error("сбивка без периода у паттерна без цикла должна быть отклонена")
+	}
+	if err := (Fill{Pattern: "rock", Every: 1}).Validate(); err == nil {
+		t.Error("сбивка в каждом такте должна быть отклонена")
+	}
+}
@@ -0,0 +1,137 @@
+package metronome
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Grouping - группировка пульсаций такта в аддитивном размере:
+// "3+2+2/8" - семь восьмых группами по три, две и две. Первая пульсация
+// каждой группы получает акцент, первая пульсация такта - сильнейший.
+type Grouping struct {
+	Groups []int // Длины групп в пульсациях
+	Unit   int   // Длительность пульсации: 8 - восьмые
+}
+
+// ParseGrouping разбирает группировку вида "3+2+2/8" или "2+2+2+3/8"
+func ParseGrouping(s string) (Grouping, error) {
+	groupsStr, unitStr, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Grouping{}, fmt.Errorf("группировка должна быть вида \"3+2+2/8\", получено '%s'", s)
+	}
+
+	unit, err := strconv.Atoi(unitStr)
+	if err != nil {
+		return Grouping{}, fmt.Errorf("группировка '%s': неверная длительность '%s'", s, unitStr)
+	}
+
+	var groups []int
+	for _, part := range strings.Split(groupsStr, "+") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return Grouping{}, fmt.Errorf("группировка '%s': неверная длина группы '%s'", s, part)
+		}
+		groups = append(groups, n)
+	}
+
+	g := Grouping{Groups: groups, Unit: unit}
+	if err := g.Meter().Validate(); err != nil {
+		return Grouping{}, fmt.Errorf("группировка '%s': %w", s, err)
+	}
+	return g, nil
+}
+
+func (g Grouping) String() string {
+	parts := make([]string, len(g.Groups))
+	for i, n := range g.Groups {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, "+") + "/" + strconv.Itoa(g.Unit)
+}
+
+// Meter возвращает размер группировки: "3+2+2/8" - 7/8
+func (g Grouping) Meter() TimeSignature {
+	total := 0
+	for _, n := range g.Groups {
+		total += n
+	}
+	return TimeSignature{Numerator: total, Denominator: g.Unit}
+}
+
+// BeatUnit возвращает счетную долю группировки - ее пульсацию. Группы
+// неравные, поэтому темп считается пульсациями, даже если их сумма
+// делится на три, как в 2+2+2+3/8.
+func (g Grouping) BeatUnit() NoteValue {
+	return g.Meter().Pulse()
+}
+
+// Group возвращает номер группы (1-based), в которую попадает пульсация
+// beat, и начинает ли она группу. Для пульсаций за пределами группировки
+// возвращает 0.
+func (g Grouping) Group(beat int) (group int, start bool) {
+	first := 1
+	for i, n := range g.Groups {
+		if beat < first+n {
+			return i + 1, beat == first
+		}
+		first += n
+	}
+	return 0, false
+}
+
+// Definition возвращает сгенерированное определение пульсации beat:
+// сильная доля такта, начало группы или обычная доля
+func (g Grouping) Definition(beat int) BeatDefinition {
+	group, start := g.Group(beat)
+	switch {
+	case beat == 1:
+		return BeatDefinition{Beat: beat, Sound: "accent", Volume: 1.0, Accent: true}
+	case start:
+		return BeatDefinition{Beat: beat, Sound: "accent", Volume: 0.8, Accent: true,
+			Comment: fmt.Sprintf("Группа %d", group)}
+	default:
+		return BeatDefinition{Beat: beat, Sound: "normal", Volume: 0.6}
+	}
+}
+
+// BeatGrouping возвращает группировку паттерна или nil, если она не
+// задана или записана с ошибкой
+func (p *Pattern) BeatGrouping() *Grouping {
+	if p.Grouping == "" {
+		return nil
+	}
+	g, err := ParseGrouping(p.Grouping)
+	if err != nil {
+		return nil
+	}
+	return &g
+}
+
+// SetGrouping задает группировку поверх паттерна: размер и счетная доля
+// (пульсация) берутся из нее, а акценты генерируются по группам вместо
+// долей паттерна. Если метроном запущен, группировка действует со
+// следующей доли.
+func (m *Metronome) SetGrouping(g Grouping) error {
+	meter := g.Meter()
+	if err := meter.Validate(); err != nil {
+		return err
+	}
+	unit := g.BeatUnit()
+
+	// Размер, счетная доля и группировка меняются вместе, чтобы
+	// планировщик не увидел новый размер со старой группировкой
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.TimeSignature = meter
+	m.BeatsPerBar = meter.Numerator
+	m.BeatUnit = unit
+	m.grouping = &g
+	if m.seq != nil {
+		m.seq.setMeter(meter, unit)
+		m.seq.grouping = &g
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package metronome
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseGrouping(t *testing.T) {
+	g, err := ParseGrouping("2+2+3/8")
+	if err != nil {
+		t.Fatalf("ParseGrouping: %v", err)
+	}
+	if g.String() != "2+2+3/8" || g.Meter() != (TimeSignature{7, 8}) {
+		t.Errorf("группировка %s, размер %s", g, g.Meter())
+	}
+
+	for _, bad := range []string{"3+2+2", "3+0/8", "3+x/8", "3+2/6", "/8"} {
+		if _, err := ParseGrouping(bad); err == nil {
+			t.Errorf("ParseGrouping(%q) должен вернуть ошибку", bad)
+		}
+	}
+}
+
+func TestGroupingAccents(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	g, _ := ParseGrouping("2+2+2+3/8")
+	if err := m.SetGrouping(g); err != nil {
+		t.Fatalf("SetGrouping: %v", err)
+	}
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	want := []string{"accent", "normal", "accent", "normal", "accent", "normal", "accent", "normal", "normal"}
+	for i, e := range collect(t, clock, events, len(want)) {
+		if e.Sound != want[i] || e.BeatsPerBar != 9 || e.Grouping == nil {
+			t.Errorf("доля %d: %q, %d долей, группировка %v; ожидалось %q", e.Beat, e.Sound, e.BeatsPerBar, e.Grouping, want[i])
+		}
+	}
+}
+
+func TestPatternGrouping(t *testing.T) {
+	pat := PredefinedPatterns()["7-8"]
+	if pat.TimeSignature() != (TimeSignature{7, 8}) {
+		t.Errorf("размер 7-8: %s", pat.TimeSignature())
+	}
+
+	var accents []int
+	for beat := 1; beat <= 7; beat++ {
+		if pat.Lookup(beat, 1).Accent {
+			accents = append(accents, beat)
+		}
+	}
+	if len(accents) != 3 || accents[0] != 1 || accents[1] != 4 || accents[2] != 6 {
+		t.Errorf("акценты 3+2+2 на долях %v, ожидалось [1 4 6]", accents)
+	}
+}
+
+func TestGroupingCountsPulses(t *testing.T) {
+	// 9/8 из неравных групп не сложный размер: темп считается восьмыми,
+	// как и в 3+2+2/8
+	spacing := func(spec string) time.Duration {
+		m, _ := newTestMetronome(t, 120, 4, "basic")
+		g, err := ParseGrouping(spec)
+		if err != nil {
+			t.Fatalf("ParseGrouping(%s): %v", spec, err)
+		}
+		if err := m.SetGrouping(g); err != nil {
+			t.Fatalf("SetGrouping(%s): %v", spec, err)
+		}
+		if m.BeatUnit != g.BeatUnit() {
+			t.Errorf("%s: счетная доля %s, ожидалась %s", spec, m.BeatUnit, g.BeatUnit())
+		}
+		seq := m.newSequencer()
+		first := seq.next()
+		return seq.next().Offset - first.Offset
+	}
+
+	if a, b := spacing("2+2+2+3/8"), spacing("3+2+2/8"); a != b || a != 500*time.Millisecond {
+		t.Errorf("восьмые: 2+2+2+3/8 через %v, 3+2+2/8 через %v, ожидалось 500ms", a, b)
+	}
+
+	eighth := (Grouping{Groups: []int{9}, Unit: 8}).BeatUnit()
+	for _, pat := range []*Pattern{
+		{Grouping: "2+2+2+3/8"},
+		{Meter: "9/8", Grouping: "2+2+2+3/8"},
+	} {
+		if pat.DefaultBeatUnit() != eighth {
+			t.Errorf("счетная доля паттерна %q с группами %s: %s", pat.Meter, pat.Grouping, pat.DefaultBeatUnit())
+		}
+	}
+	// Группировка другого размера счетную долю не меняет
+	if pat := (&Pattern{Meter: "6/8", Grouping: "3+2+2/8"}); pat.DefaultBeatUnit() != Quarter*1.5 {
+		t.Errorf("6/8 с группами 3+2+2/8: %s", pat.DefaultBeatUnit())
+	}
+}
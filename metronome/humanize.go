@@ -0,0 +1,97 @@
+package metronome
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// MaxHumanizeTiming - наибольший разброс времени удара. Больше уже не
+// "живая" игра, а промахи мимо доли.
+const MaxHumanizeTiming = 50.0
+
+// Humanize - управляемые отклонения щелчков от сетки для тренировки
+// грува под "неидеальный" метроном. Отклонения берутся из генератора
+// секвенсора, поэтому при одном зерне живое воспроизведение и WAV
+// совпадают удар в удар.
+type Humanize struct {
+	TimingMs float64 `json:"timing_ms"`      // Разброс времени удара в мс (±)
+	Velocity float64 `json:"velocity"`       // Разброс громкости как доля от нее (0.0-1.0)
+	Seed     int64   `json:"seed,omitempty"` // Зерно случайности; 0 - случайное
+}
+
+// Validate проверяет настройки humanize
+func (h Humanize) Validate() error {
+	if h.TimingMs < 0 || h.TimingMs > MaxHumanizeTiming {
+		return fmt.Errorf("разброс времени должен быть от 0 до %.0f мс", MaxHumanizeTiming)
+	}
+	if h.Velocity < 0 || h.Velocity > 1 {
+		return fmt.Errorf("разброс громкости должен быть от 0 до 1")
+	}
+	return nil
+}
+
+// Enabled сообщает, есть ли какие-то отклонения
+func (h Humanize) Enabled() bool {
+	return h.TimingMs > 0 || h.Velocity > 0
+}
+
+// humanizeState применяет отклонения внутри секвенсора. Настройки
+// метронома важнее настроек паттерна; генератор создается с зерном тех
+// настроек, что сработали первыми.
+type humanizeState struct {
+	rules *Humanize // Настройки метронома; nil - берутся из паттерна
+	rng   *rand.Rand
+}
+
+func newHumanizeState(rules *Humanize) *humanizeState {
+	return &humanizeState{rules: rules}
+}
+
+// apply сдвигает удар и меняет его громкость. Случайные числа берутся
+// для каждого удара парой, даже если одно из отклонений выключено, чтобы
+// последовательность при одном зерне не зависела от настроек.
+func (h *humanizeState) apply(event *TickEvent, pattern *Humanize) {
+	rules := h.rules
+	if rules == nil {
+		rules = pattern
+	}
+	if rules == nil || !rules.Enabled() {
+		return
+	}
+
+	if h.rng == nil {
+		seed := rules.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		h.rng = rand.New(rand.NewSource(seed))
+	}
+	timing := 2*h.rng.Float64() - 1
+	velocity := 2*h.rng.Float64() - 1
+
+	shift := int64(math.Round(timing * rules.TimingMs / 1000 * float64(sampleRate)))
+	// Самый первый удар раньше начала шкалы не сдвинуть
+	shift = max(shift, -event.sample)
+	grid := event.Offset
+	event.sample += shift
+	event.Offset = samplesToDuration(event.sample)
+	event.Shift = event.Offset - grid
+
+	gain := 1 + velocity*rules.Velocity
+	event.Volume = clampVolume(event.Volume * gain)
+	if len(event.Hits) > 0 {
+		hits := make([]LayerHit, len(event.Hits))
+		for i, hit := range event.Hits {
+			hit.Volume = clampVolume(hit.Volume * gain)
+			hits[i] = hit
+		}
+		event.Hits = hits
+	}
+}
+
+// clampVolume ограничивает громкость диапазоном 0.0-1.0
+func clampVolume(v float64) float64 {
+	return min(max(v, 0), 1)
+}
@@ -0,0 +1,71 @@
+package metronome
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHumanizeLiveMatchesRender(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	h := Humanize{TimingMs: 20, Velocity: 0.3, Seed: 42}
+	if err := m.SetHumanize(h); err != nil {
+		t.Fatalf("SetHumanize: %v", err)
+	}
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	live := collect(t, clock, events, 8)
+	m.Stop()
+
+	// WAV берет удары из нового секвенсора с теми же настройками
+	seq := m.newSequencer()
+	shifted := false
+	for i, got := range live {
+		want := seq.next()
+		if got.Offset != want.Offset || got.Volume != want.Volume {
+			t.Errorf("удар %d: живой %v/%.3f, в WAV %v/%.3f", i, got.Offset, got.Volume, want.Offset, want.Volume)
+		}
+
+		grid := time.Duration(i) * 500 * time.Millisecond
+		if d := got.Offset - grid; d != got.Shift || d.Abs() > 20*time.Millisecond {
+			t.Errorf("удар %d сдвинут на %v (Shift %v), допустимо ±20ms", i, d, got.Shift)
+		}
+		if got.Shift != 0 {
+			shifted = true
+		}
+	}
+	if !shifted {
+		t.Error("ни один удар не сдвинут")
+	}
+}
+
+func TestHumanizeFromPattern(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	pat := *m.Pattern
+	pat.Humanize = &Humanize{Velocity: 0.5, Seed: 7}
+	m.Pattern = &pat
+
+	a, b := m.newSequencer(), m.newSequencer()
+	varied := false
+	for range 8 {
+		ea, eb := a.next(), b.next()
+		if ea.Volume != eb.Volume || ea.Shift != 0 {
+			t.Fatalf("при одном зерне удары должны совпадать и не сдвигаться: %+v / %+v", ea, eb)
+		}
+		if ea.Volume != pat.Lookup(ea.Beat, ea.Bar).Volume {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Error("громкость не меняется")
+	}
+}
+
+func TestHumanizeValidate(t *testing.T) {
+	for _, h := range []Humanize{{TimingMs: -1}, {TimingMs: MaxHumanizeTiming + 1}, {Velocity: 1.5}} {
+		if err := h.Validate(); err == nil {
+			t.Errorf("%+v должен быть отклонен", h)
+		}
+	}
+}
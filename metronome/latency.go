@@ -0,0 +1,92 @@
+package metronome
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	// MinLatency - наименьшая задержка: события не могут прийти раньше,
+	// чем доля попала в окно планирования
+	MinLatency = -150 * time.Millisecond
+	// MaxLatency - наибольшая задержка звука
+	MaxLatency = time.Second
+)
+
+// minCalibrationTaps - сколько попавших в такт нажатий нужно для оценки
+const minCalibrationTaps = 4
+
+// SetLatency задает задержку звука относительно событий. Подписчики
+// получают доли на latency позже постановки в аудиопоток, поэтому
+// картинка совпадает с тем, что слышно. Отрицательная задержка
+// отправляет события раньше.
+func (m *Metronome) SetLatency(latency time.Duration) error {
+	if latency < MinLatency || latency > MaxLatency {
+		return fmt.Errorf("задержка должна быть от %d до %d мс",
+			MinLatency.Milliseconds(), MaxLatency.Milliseconds())
+	}
+
+	m.mu.Lock()
+	m.latency = latency
+	m.mu.Unlock()
+
+	return nil
+}
+
+// EstimateLatency оценивает задержку звука по калибровке: ticks - моменты
+// постановки щелчков в аудиопоток (Timestamp событий без компенсации),
+// taps - моменты нажатий пользователя, отстукивающего услышанные щелчки.
+// Каждое нажатие сопоставляется с ближайшим щелчком; нажатия дальше
+// половины интервала от щелчков отбрасываются. Результат - медиана
+// расхождений, устойчивая к отдельным промахам.
+func EstimateLatency(ticks, taps []time.Time) (time.Duration, error) {
+	if len(ticks) < 2 {
+		return 0, fmt.Errorf("для калибровки нужно хотя бы два щелчка")
+	}
+
+	ticks = slices.Clone(ticks)
+	sort.Slice(ticks, func(i, j int) bool { return ticks[i].Before(ticks[j]) })
+
+	intervals := make([]time.Duration, len(ticks)-1)
+	for i := 1; i < len(ticks); i++ {
+		intervals[i-1] = ticks[i].Sub(ticks[i-1])
+	}
+	limit := median(intervals) / 2
+
+	var diffs []time.Duration
+	for _, tap := range taps {
+		// Ближайший щелчок: первый не раньше нажатия или предыдущий
+		i := sort.Search(len(ticks), func(i int) bool { return !ticks[i].Before(tap) })
+		best := time.Duration(1<<63 - 1)
+		for _, j := range []int{i - 1, i} {
+			if j < 0 || j >= len(ticks) {
+				continue
+			}
+			if diff := tap.Sub(ticks[j]); diff.Abs() < best.Abs() {
+				best = diff
+			}
+		}
+		if best.Abs() < limit {
+			diffs = append(diffs, best)
+		}
+	}
+
+	if len(diffs) < minCalibrationTaps {
+		return 0, fmt.Errorf("слишком мало нажатий в такт: %d из %d нужных", len(diffs), minCalibrationTaps)
+	}
+	return median(diffs), nil
+}
+
+// median возвращает медиану непустого набора длительностей
+func median(values []time.Duration) time.Duration {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,59 @@
+package metronome
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyDelaysEvents(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetLatency(100 * time.Millisecond); err != nil {
+		t.Fatalf("SetLatency: %v", err)
+	}
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	for i := range 3 {
+		event := collect(t, clock, events, 1)[0]
+		want := testStart.Add(time.Duration(i)*500*time.Millisecond + 100*time.Millisecond)
+		if now := clock.Now(); now.Before(want) || now.Sub(want) >= testStep {
+			t.Errorf("доля %d пришла в %v, ожидалось %v", event.Beat, now.Sub(testStart), want.Sub(testStart))
+		}
+	}
+}
+
+func TestSetLatencyRange(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	for _, latency := range []time.Duration{MinLatency - time.Millisecond, MaxLatency + time.Millisecond} {
+		if err := m.SetLatency(latency); err == nil {
+			t.Errorf("SetLatency(%v) должен вернуть ошибку", latency)
+		}
+	}
+}
+
+func TestEstimateLatency(t *testing.T) {
+	var ticks, taps []time.Time
+	for i := range 8 {
+		ticks = append(ticks, testStart.Add(time.Duration(i)*600*time.Millisecond))
+	}
+	// Нажатия в среднем на 80 мс позже щелчков, одно мимо и одно лишнее
+	for i, delta := range []int{70, 90, 80, 250, 85, 75, 80} {
+		taps = append(taps, ticks[i+1].Add(time.Duration(delta)*time.Millisecond))
+	}
+	taps = append(taps, testStart.Add(-time.Second))
+
+	got, err := EstimateLatency(ticks, taps)
+	if err != nil {
+		t.Fatalf("EstimateLatency: %v", err)
+	}
+	if want := 80 * time.Millisecond; got != want {
+		t.Errorf("задержка %v, ожидалось %v", got, want)
+	}
+
+	if _, err := EstimateLatency(ticks, taps[:2]); err == nil {
+		t.Error("при двух нажатиях должна быть ошибка")
+	}
+}
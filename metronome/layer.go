@@ -0,0 +1,69 @@
+package metronome
+
+// Layer - независимый голос полиритмии. Его удары делят такт поровну
+// независимо от основных долей: слой с Pulses = 3 в такте 4/4 дает
+// полиритмию 3:4. Маска Steps оставляет звучать только часть из них.
+type Layer struct {
+	Name   string  `json:"name"`
+	Pulses int     `json:"pulses"`          // Количество ударов (шагов) слоя за такт
+	Steps  string  `json:"steps,omitempty"` // Маска шагов: x - удар, . - пауза
+	Sound  string  `json:"sound"`           // Тип звука
+	Volume float64 `json:"volume"`          // Громкость (0.0-1.0)
+}
+
+// plays сообщает, звучит ли шаг k (0-based) слоя
+func (l Layer) plays(k int) bool {
+	return l.Steps == "" || (k < len(l.Steps) && l.Steps[k] == 'x')
+}
+
+// LayerHit - удар слоя полиритмии, совпавший с событием
+type LayerHit struct {
+	Layer  string  // Название слоя
+	Index  int     // Номер удара слоя в такте (1-based)
+	Pulses int     // Всего ударов слоя за такт
+	Sound  string  // Тип звука
+	Volume float64 // Громкость (0.0-1.0)
+
+	length int // Интервал между ударами слоя в семплах
+}
+
+// layerHit - удар слоя с положением внутри доли в виде дроби num/den
+type layerHit struct {
+	num, den int
+	hit      LayerHit
+}
+
+// layerHitsInPulse возвращает удары слоев, попадающие в пульсацию pulse
+// (0-based) такта из pulses пульсаций. Положение считается в целых числах,
+// чтобы удары, совпадающие с долей или подразделением, не расходились
+// из-за округления.
+func layerHitsInPulse(layers []Layer, pulses, pulse int, samplesPerPulse float64) []layerHit {
+	var hits []layerHit
+	for _, layer := range layers {
+		if layer.Pulses < 1 {
+			continue
+		}
+
+		interval := int(samplesPerPulse * float64(pulses) / float64(layer.Pulses))
+		for k := 0; k < layer.Pulses; k++ {
+			// Удар k находится в позиции k*pulses/layer.Pulses пульсаций
+			at := k * pulses
+			if at/layer.Pulses != pulse || !layer.plays(k) {
+				continue
+			}
+			hits = append(hits, layerHit{
+				num: at % layer.Pulses,
+				den: layer.Pulses,
+				hit: LayerHit{
+					Layer:  layer.Name,
+					Index:  k + 1,
+					Pulses: layer.Pulses,
+					Sound:  layer.Sound,
+					Volume: layer.Volume,
+					length: interval,
+				},
+			})
+		}
+	}
+	return hits
+}
@@ -0,0 +1,99 @@
+package metronome
+
+import (
+	"slices"
+	"testing"
+)
+
+// layerGrid играет bars тактов паттерна и возвращает позиции основных долей,
+// позиции ударов слоев и число событий, где звучат только слои
+func layerGrid(t *testing.T, pattern string, subdivision, bars int) (beats, hits []int64, layerOnly int) {
+	t.Helper()
+
+	m, _ := newTestMetronome(t, 120, 4, pattern)
+	if subdivision > 1 {
+		if err := m.SetSubdivision(subdivision); err != nil {
+			t.Fatalf("SetSubdivision: %v", err)
+		}
+	}
+
+	seq := m.newSequencer()
+	for {
+		e := seq.next()
+		if e.Bar > bars {
+			return beats, hits, layerOnly
+		}
+		if e.SubBeat == 0 && !e.LayerOnly {
+			beats = append(beats, e.sample)
+		}
+		if e.LayerOnly {
+			layerOnly++
+		}
+		for range e.Hits {
+			hits = append(hits, e.sample)
+		}
+	}
+}
+
+// evenGrid возвращает n равных долей каждого из bars тактов длиной bar семплов
+func evenGrid(bar float64, n, bars int) []int64 {
+	var grid []int64
+	for i := 0; i < n*bars; i++ {
+		grid = append(grid, int64(bar*float64(i)/float64(n)+0.5))
+	}
+	return grid
+}
+
+func TestPolyLayerGrid(t *testing.T) {
+	// При 120 BPM такт 4/4 длится 88200 семплов
+	const bar = 88200
+	for _, tc := range []struct {
+		pattern   string
+		pulses    int
+		layerOnly int // Удары слоя мимо основных долей за два такта
+	}{
+		{"poly", 3, 4},
+		{"poly-5-4", 5, 8},
+	} {
+		beats, hits, layerOnly := layerGrid(t, tc.pattern, 1, 2)
+		if want := evenGrid(bar, 4, 2); !slices.Equal(beats, want) {
+			t.Errorf("%s: доли %v, ожидалось %v", tc.pattern, beats, want)
+		}
+		if want := evenGrid(bar, tc.pulses, 2); !slices.Equal(hits, want) {
+			t.Errorf("%s: удары слоя %v, ожидалось %v", tc.pattern, hits, want)
+		}
+		if layerOnly != tc.layerOnly {
+			t.Errorf("%s: %d ударов только слоя, ожидалось %d", tc.pattern, layerOnly, tc.layerOnly)
+		}
+	}
+}
+
+func TestPolyLayerPositions(t *testing.T) {
+	// 3:4 - удары слоя на трети такта: первый с долей 1, второй в первой
+	// трети доли 2, третий на двух третях доли 3
+	_, hits, _ := layerGrid(t, "poly", 1, 1)
+	if want := []int64{0, 22050 + 7350, 44100 + 14700}; !slices.Equal(hits, want) {
+		t.Errorf("poly: удары слоя %v, ожидалось %v", hits, want)
+	}
+
+	// 5:4 - шаг слоя 17640 семплов, четыре пятых доли
+	_, hits, _ = layerGrid(t, "poly-5-4", 1, 1)
+	if want := []int64{0, 17640, 22050 + 13230, 44100 + 8820, 66150 + 4410}; !slices.Equal(hits, want) {
+		t.Errorf("poly-5-4: удары слоя %v, ожидалось %v", hits, want)
+	}
+}
+
+func TestPolyLayerOnTriplets(t *testing.T) {
+	// С триолями удары слоя 3:4 совпадают с подразделениями и не дают
+	// отдельных событий
+	beats, hits, layerOnly := layerGrid(t, "poly", 3, 1)
+	if want := evenGrid(88200, 4, 1); !slices.Equal(beats, want) {
+		t.Errorf("доли %v, ожидалось %v", beats, want)
+	}
+	if want := evenGrid(88200, 3, 1); !slices.Equal(hits, want) {
+		t.Errorf("удары слоя %v, ожидалось %v", hits, want)
+	}
+	if layerOnly != 0 {
+		t.Errorf("%d ударов только слоя при триолях", layerOnly)
+	}
+}
@@ -0,0 +1,179 @@
+package metronome
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NoteValue - длительность ноты в долях целой: 0.25 - четверть,
+// 0.375 - четверть с точкой, 1/12 - восьмая триоль
+type NoteValue float64
+
+const (
+	Whole   NoteValue = 1
+	Half    NoteValue = 0.5
+	Quarter NoteValue = 0.25
+	Eighth  NoteValue = 0.125
+)
+
+// ParseNoteValue разбирает длительность: "4" - четверть, "4." - четверть
+// с точкой, "8t" - восьмая триоль, "3/8" - дробь от целой
+func ParseNoteValue(s string) (NoteValue, error) {
+	s = strings.TrimSpace(s)
+
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err1 := strconv.Atoi(num)
+		d, err2 := strconv.Atoi(den)
+		if err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+			return 0, fmt.Errorf("неверная длительность '%s'", s)
+		}
+		return NoteValue(float64(n) / float64(d)), nil
+	}
+
+	factor := 1.0
+	base := s
+	switch {
+	case strings.HasSuffix(s, "."):
+		factor = 1.5
+		base = strings.TrimSuffix(s, ".")
+	case strings.HasSuffix(s, "t"):
+		factor = 2.0 / 3.0
+		base = strings.TrimSuffix(s, "t")
+	}
+
+	den, err := strconv.Atoi(base)
+	if err != nil || !isPowerOfTwo(den) || den > 64 {
+		return 0, fmt.Errorf("неверная длительность '%s'", s)
+	}
+	return NoteValue(factor / float64(den)), nil
+}
+
+// String возвращает длительность в записи ParseNoteValue
+func (v NoteValue) String() string {
+	for den := 1; den <= 64; den *= 2 {
+		switch {
+		case approxEqual(float64(v), 1/float64(den)):
+			return strconv.Itoa(den)
+		case approxEqual(float64(v), 1.5/float64(den)):
+			return strconv.Itoa(den) + "."
+		case approxEqual(float64(v), 2.0/3.0/float64(den)):
+			return strconv.Itoa(den) + "t"
+		}
+	}
+	return strconv.FormatFloat(float64(v), 'g', 4, 64)
+}
+
+// TimeSignature - музыкальный размер: числитель - количество пульсаций
+// в такте, знаменатель - их длительность
+type TimeSignature struct {
+	Numerator   int
+	Denominator int
+}
+
+// ParseTimeSignature разбирает размер вида "6/8"
+func ParseTimeSignature(s string) (TimeSignature, error) {
+	num, den, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return TimeSignature{}, fmt.Errorf("неверный размер '%s'", s)
+	}
+
+	n, err1 := strconv.Atoi(strings.TrimSpace(num))
+	d, err2 := strconv.Atoi(strings.TrimSpace(den))
+	if err1 != nil || err2 != nil {
+		return TimeSignature{}, fmt.Errorf("неверный размер '%s'", s)
+	}
+
+	ts := TimeSignature{Numerator: n, Denominator: d}
+	if err := ts.Validate(); err != nil {
+		return TimeSignature{}, err
+	}
+	return ts, nil
+}
+
+// Validate проверяет размер
+func (ts TimeSignature) Validate() error {
+	if ts.Numerator < 1 || ts.Numerator > 32 {
+		return fmt.Errorf("количество долей должно быть от 1 до 32")
+	}
+	if !isPowerOfTwo(ts.Denominator) || ts.Denominator > 64 {
+		return fmt.Errorf("знаменатель размера должен быть степенью двойки")
+	}
+	return nil
+}
+
+func (ts TimeSignature) String() string {
+	return fmt.Sprintf("%d/%d", ts.Numerator, ts.Denominator)
+}
+
+// Pulse возвращает длительность одной пульсации такта
+func (ts TimeSignature) Pulse() NoteValue {
+	return NoteValue(1 / float64(ts.Denominator))
+}
+
+// Compound сообщает, что размер сложный (6/8, 9/8, 12/8): пульсации
+// группируются по три, и счетная доля - четверть с точкой
+func (ts TimeSignature) Compound() bool {
+	return ts.Denominator >= 8 && ts.Numerator > 3 && ts.Numerator%3 == 0
+}
+
+// DefaultBeatUnit возвращает счетную долю, к которой относится темп:
+// в сложных размерах это три пульсации, иначе - одна
+func (ts TimeSignature) DefaultBeatUnit() NoteValue {
+	if ts.Compound() {
+		return 3 * ts.Pulse()
+	}
+	return ts.Pulse()
+}
+
+// CommonTime возвращает размер n/4
+func CommonTime(beats int) TimeSignature {
+	return TimeSignature{Numerator: beats, Denominator: 4}
+}
+
+// MarshalJSON сохраняет размер строкой "6/8"
+func (ts TimeSignature) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(ts.String())), nil
+}
+
+// UnmarshalJSON читает размер из строки "6/8"
+func (ts *TimeSignature) UnmarshalJSON(data []byte) error {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("размер должен быть строкой вида \"6/8\"")
+	}
+	parsed, err := ParseTimeSignature(s)
+	if err != nil {
+		return err
+	}
+	*ts = parsed
+	return nil
+}
+
+// MarshalJSON сохраняет длительность строкой "4."
+func (v NoteValue) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(v.String())), nil
+}
+
+// UnmarshalJSON читает длительность из строки "4."
+func (v *NoteValue) UnmarshalJSON(data []byte) error {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("длительность должна быть строкой вида \"4.\"")
+	}
+	parsed, err := ParseNoteValue(s)
+	if err != nil {
+		return err
+	}
+	*v = parsed
+	return nil
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
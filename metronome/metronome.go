@@ -2,21 +2,59 @@ package metronome
 
 import (
 	"fmt"
+	"io"
+	"math"
+	"os"
 	"sync"
 	"time"
 )
 
 type Metronome struct {
-	BPM         int
-	BeatsPerBar int
-	Pattern     *Pattern
-	Running     bool
-	mu          sync.Mutex
-	stopChan    chan struct{}
-	ticker      *time.Ticker
-	subscribers []chan TickEvent
-	beatCount   int
-	barCount    int
+	BPM           int
+	Pan           float64 // Панорама: -1 - левый канал, 0 - центр, 1 - правый
+	BeatsPerBar   int
+	TimeSignature TimeSignature // Размер; BeatsPerBar - его числитель
+	BeatUnit      NoteValue     // Счетная доля, к которой относится BPM
+	Pattern       *Pattern
+	Running       bool // Идет воспроизведение (не пауза и не остановка)
+	mu            sync.Mutex
+	state         TransportState
+	quit          chan struct{}    // Останавливает текущий цикл планировщика
+	done          chan struct{}    // Закрывается при остановке
+	subscribers   []chan TickEvent // Каналы Subscribe; под subsMu
+	subsMu        sync.Mutex       // Не дает закрыть канал во время отправки
+	bus           *eventBus
+	outbox        []Event    // События, ждущие рассылки после снятия mu
+	publishing    sync.Mutex // Рассылка outbox идет в одной горутине за раз
+	beatCount     int
+	barCount      int
+
+	tempo         float64        // Текущий темп последней прозвучавшей доли
+	lastPattern   *Pattern       // Паттерн последней прозвучавшей доли
+	ramp          *TempoRamp     // Переход темпа, запускаемый вместе с метрономом
+	trainer       *TrainerConfig // Тренажер скорости, запускаемый вместе с метрономом
+	trainerStatus *TrainerStatus // Состояние тренажера на последней доле
+	mute          *MuteRules     // Правила приглушения долей
+	humanize      *Humanize      // Отклонения от сетки; nil - по паттерну
+	trigSeed      int64          // Зерно условий долей; 0 - из паттерна
+	limit         *SessionLimit  // Предел занятия
+	grouping      *Grouping      // Группировка поверх паттерна
+	fill          *Fill          // Сбивка поверх паттерна и песни
+	stats         *sessionStats  // Итоги занятия с последнего запуска
+	subdivision   int            // Деление долей без собственного Subdiv
+	song          *Song          // Песня; nil - один паттерн без конца
+	section       string         // Текущий раздел песни
+	countIn       CountIn        // Отсчет перед первым тактом
+	seq           *sequencer     // Планировщик долей на временной шкале
+	out           output         // Аудиовыход; nil - без звука
+	clock         Clock          // Часы планировщика
+	startTime     time.Time      // Абсолютное начало временной шкалы
+	pending       []TickEvent    // Запланированные, но еще не наступившие доли
+	pausedAt      time.Duration  // Позиция на шкале, с которой продолжить игру
+	latency       time.Duration  // Задержка звука: на столько позже рассылаются доли
+	quiet         bool           // Не печатать доли в консоль
+	ensemble      *Ensemble      // Ансамбль, который сейчас играет метроном
+	progress      io.Writer      // Куда печатаются доли и сообщения
 }
 
 type TickEvent struct {
@@ -25,9 +63,51 @@ type TickEvent struct {
 	Volume    float64 // Громкость (0.0-1.0)
 	Sound     string  // Тип звука: accent, normal, ghost, etc
 	Timestamp time.Time
+	Offset    time.Duration // Положение доли от начала воспроизведения
+	Shift     time.Duration // Отклонение от сетки из-за humanize (уже учтено в Offset)
+	Pan       float64       // Панорама метронома, сыгравшего долю
+
+	Tempo        float64        // Текущий темп (дробный во время перехода)
+	TempoChanged bool           // Темп сменился скачком начиная с этой доли
+	Trainer      *TrainerStatus // Состояние тренажера; nil если он не активен
+	Muted        bool           // Доля приглушена правилами и не звучит
+
+	BeatsPerBar    int           // Количество долей в текущем такте
+	TimeSignature  TimeSignature // Размер текущего такта
+	Section        string        // Раздел песни; пусто вне режима песни
+	SectionChanged bool          // С этой доли начинается новый раздел
+
+	Modulation *MetricModulation // Метрическая модуляция, сменившая темп с этой доли
+
+	SubBeat     int        // Подразделение внутри доли: 0 - сама доля
+	Subdivision int        // На сколько частей делится доля
+	Hits        []LayerHit // Удары слоев полиритмии в этот момент
+	LayerOnly   bool       // Звучат только слои, основной доли нет
+
+	LastBar  bool      // Последний такт сессии, на сильной доле - предупреждение
+	Grouping *Grouping // Группировка долей такта; nil - без группировки
+	Fill     bool      // Доля такта сбивки
+
+	CountIn bool // Доля отсчета; Bar при этом отрицательный: -2, -1
+	Count   int  // Счет доли отсчета: "1 . 2 ." - 0 на пропущенных долях
+
+	sample  int64    // Положение доли в семплах
+	length  int      // Длина доли в семплах
+	pattern *Pattern // Паттерн, по которому сыграна доля
+}
+
+// Audible сообщает, должна ли доля прозвучать
+func (e TickEvent) Audible() bool {
+	return !e.Muted && !e.LayerOnly && e.Sound != "silent"
 }
 
 func NewMetronome(bpm, beats int, pattern *Pattern) (*Metronome, error) {
+	return NewMetronomeWithClock(bpm, beats, pattern, RealClock{})
+}
+
+// NewMetronomeWithClock создает метроном, планировщик которого идет по
+// часам clock. С FakeClock воспроизведение можно проверять без ожидания.
+func NewMetronomeWithClock(bpm, beats int, pattern *Pattern, clock Clock) (*Metronome, error) {
 	if bpm < 20 || bpm > 300 {
 		return nil, fmt.Errorf("BPM должен быть от 20 до 300")
 	}
@@ -35,135 +115,173 @@ func NewMetronome(bpm, beats int, pattern *Pattern) (*Metronome, error) {
 		return nil, fmt.Errorf("количество долей должно быть от 1 до 32")
 	}
 
+	// Если размер паттерна совпадает по числу долей, берем его целиком
+	// (7/8, 12/8), иначе считаем доли четвертями
+	meter := CommonTime(beats)
+	beatUnit := Quarter
+	if pattern != nil && pattern.TimeSignature().Numerator == beats {
+		meter = pattern.TimeSignature()
+		beatUnit = pattern.DefaultBeatUnit()
+	}
+
 	return &Metronome{
-		BPM:         bpm,
-		BeatsPerBar: beats,
-		Pattern:     pattern,
-		Running:     false,
-		stopChan:    make(chan struct{}),
-		subscribers: make([]chan TickEvent, 0),
-		beatCount:   0,
-		barCount:    1,
+		BPM:           bpm,
+		BeatsPerBar:   beats,
+		TimeSignature: meter,
+		BeatUnit:      beatUnit,
+		Pattern:       pattern,
+		Running:       false,
+		done:          make(chan struct{}),
+		bus:           &eventBus{},
+		beatCount:     0,
+		barCount:      1,
+		out:           &speakerOutput{},
+		clock:         clock,
+		progress:      os.Stdout,
 	}, nil
 }
 
-func (m *Metronome) Start() error {
+// schedule ставит в аудиопоток все доли, попадающие в окно scheduleAhead,
+// и рассылает наступившие доли. Возвращает время до следующего вызова.
+func (m *Metronome) schedule() time.Duration {
 	m.mu.Lock()
-	if m.Running {
+	if m.state != TransportPlaying {
 		m.mu.Unlock()
-		return fmt.Errorf("метроном уже запущен")
+		return schedulerInterval
 	}
-	m.Running = true
-	m.mu.Unlock()
-
-	interval := time.Duration(float64(time.Minute) / float64(m.BPM))
-
-	m.ticker = time.NewTicker(interval)
-	m.beatCount = 0
-	m.barCount = 1
-
-	go func() {
-		for {
-			select {
-			case <-m.ticker.C:
-				m.handleTick()
-			case <-m.stopChan:
-				m.ticker.Stop()
-				return
-			}
+	now := m.clock.Now().Sub(m.startTime)
+
+	for !m.seq.finished() && m.seq.offset() < now+scheduleAhead {
+		event := m.seq.next()
+		event.Timestamp = m.startTime.Add(event.Offset)
+		event.Pan = m.Pan
+		if m.out != nil {
+			m.out.Schedule(event)
 		}
-	}()
-
-	return nil
-}
+		m.pending = append(m.pending, event)
+	}
 
-func (m *Metronome) handleTick() {
-	m.beatCount++
-	if m.beatCount > m.BeatsPerBar {
-		m.beatCount = 1
-		m.barCount++
+	var due []TickEvent
+	// Доли рассылаются, когда их слышно, то есть с поправкой на задержку звука
+	for len(m.pending) > 0 && m.pending[0].Offset+m.latency <= now {
+		event := m.pending[0]
+		m.pending = m.pending[1:]
+		due = append(due, event)
+		m.emit(m.track(event)...)
 	}
+	// Последняя доля должна дозвучать: конец - там, где была бы следующая
+	finished := m.seq.finished() && len(m.pending) == 0 && m.seq.offset() <= now
+
+	wait := schedulerInterval
+	if len(m.pending) > 0 {
+		wait = min(wait, m.pending[0].Offset+m.latency-now)
+	} else if m.seq.finished() {
+		wait = min(wait, max(m.seq.offset()-now, 0))
+	}
+	m.mu.Unlock()
 
-	// Получаем настройки для этой доли из паттерна
-	soundType, volume := m.Pattern.GetSound(m.beatCount, m.barCount)
+	for _, event := range due {
+		m.handleTick(event)
+	}
+	m.flush()
 
-	event := TickEvent{
-		Beat:      m.beatCount,
-		Bar:       m.barCount,
-		Volume:    volume,
-		Sound:     soundType,
-		Timestamp: time.Now(),
+	// Песня или занятие доиграны - останавливаемся сами
+	if finished {
+		m.stop(true)
 	}
 
-	// Отправляем звук
-	m.playSound(event)
+	return wait
+}
 
+func (m *Metronome) handleTick(event TickEvent) {
 	// Уведомляем подписчиков
 	m.notifySubscribers(event)
 
 	// Визуальный индикатор в консоли
-	m.printVisual(event)
-}
-
-func (m *Metronome) playSound(event TickEvent) {
-	// Генерируем и проигрываем звук
-	GenerateAndPlaySound(event.Sound, event.Volume, m.BPM)
+	if !m.quiet {
+		m.printVisual(event)
+	}
 }
 
 func (m *Metronome) printVisual(event TickEvent) {
+	if event.CountIn {
+		if event.Beat == 1 {
+			fmt.Fprintf(m.progress, "\n[%3d] ", event.Bar)
+		}
+		if event.Count == 0 {
+			fmt.Fprint(m.progress, ". ")
+		} else {
+			fmt.Fprintf(m.progress, "%d ", event.Count)
+		}
+		return
+	}
+
 	var marker string
-	switch event.Sound {
-	case "accent":
+	switch {
+	case event.Muted:
+		marker = "·"
+	case event.LayerOnly:
+		marker = "×"
+	case event.SubBeat > 0:
+		marker = "-"
+	case event.Sound == "accent":
 		marker = "█"
-	case "normal":
+	case event.Sound == "normal":
 		marker = "▓"
-	case "ghost":
+	case event.Sound == "ghost":
 		marker = "░"
-	case "silent":
+	case event.Sound == "silent":
 		marker = " "
+	case event.Sound == "warning":
+		marker = "!"
+	case event.Sound == "crash":
+		marker = "*"
 	default:
 		marker = "▒"
 	}
 
-	if event.Beat == 1 {
-		fmt.Printf("\n[%03d] ", event.Bar)
+	if event.Beat == 1 && event.SubBeat == 0 {
+		fmt.Fprintf(m.progress, "\n[%03d] ", event.Bar)
+		if event.LastBar {
+			fmt.Fprint(m.progress, "(последний) ")
+		}
+		if event.Fill {
+			fmt.Fprint(m.progress, "(сбивка) ")
+		}
+	} else if event.Grouping != nil && event.SubBeat == 0 && !event.LayerOnly {
+		// Граница группы аддитивного размера
+		if _, start := event.Grouping.Group(event.Beat); start {
+			fmt.Fprint(m.progress, "| ")
+		}
 	}
 
-	fmt.Printf("%s ", marker)
+	fmt.Fprintf(m.progress, "%s ", marker)
 }
 
-func (m *Metronome) Stop() {
+// SetProgressWriter задает, куда печатаются доли и сообщения метронома
+// (по умолчанию stdout). Вызывается до запуска.
+func (m *Metronome) SetProgressWriter(w io.Writer) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if !m.Running {
-		return
-	}
-
-	m.Running = false
-	close(m.stopChan)
-
-	// Закрываем каналы подписчиков
-	for _, ch := range m.subscribers {
-		close(ch)
-	}
-	m.subscribers = nil
+	m.progress = w
+	m.mu.Unlock()
 }
 
+// Subscribe возвращает канал долей. Канал закрывается при остановке
+// метронома (но не на паузе); типизированные события и отписку без
+// остановки дает SubscribeEvents.
 func (m *Metronome) Subscribe() <-chan TickEvent {
 	ch := make(chan TickEvent, 100)
-	m.mu.Lock()
+	m.subsMu.Lock()
 	m.subscribers = append(m.subscribers, ch)
-	m.mu.Unlock()
+	m.subsMu.Unlock()
 	return ch
 }
 
 func (m *Metronome) notifySubscribers(event TickEvent) {
-	m.mu.Lock()
-	subscribers := m.subscribers
-	m.mu.Unlock()
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
 
-	for _, ch := range subscribers {
+	for _, ch := range m.subscribers {
 		select {
 		case ch <- event:
 		default:
@@ -172,50 +290,247 @@ func (m *Metronome) notifySubscribers(event TickEvent) {
 	}
 }
 
+// closeSubscribers закрывает и забывает каналы Subscribe
+func (m *Metronome) closeSubscribers() {
+	m.subsMu.Lock()
+	defer m.subsMu.Unlock()
+
+	for _, ch := range m.subscribers {
+		close(ch)
+	}
+	m.subscribers = nil
+}
+
+// newSequencer создает секвенсор с текущими настройками метронома
+func (m *Metronome) newSequencer() *sequencer {
+	seq := newSequencer(m.BPM, m.TimeSignature, m.BeatUnit, m.Pattern)
+	if m.countIn.Bars > 0 {
+		seq.countIn = newCountInState(m.countIn)
+	}
+	if m.ramp != nil {
+		if seq.countIn != nil {
+			seq.countIn.ramp = m.ramp
+		} else {
+			seq.startRamp(*m.ramp)
+		}
+	}
+	if m.trainer != nil {
+		seq.trainer = newTrainerState(*m.trainer)
+	}
+	if m.mute != nil {
+		seq.mute = newMuteState(*m.mute)
+	}
+	if m.song != nil {
+		seq.song = newSongState(m.song)
+	}
+	seq.humanize = newHumanizeState(m.humanize)
+	seq.trig = &trigState{seed: m.trigSeed}
+	seq.grouping = m.grouping
+	seq.fill = m.fill
+	if m.limit != nil {
+		seq.limit = &limitState{SessionLimit: *m.limit}
+	}
+	seq.subdivision = m.subdivision
+	return seq
+}
+
+// SetBPM мгновенно меняет темп со следующей доли, не останавливая
+// воспроизведение. Активный переход темпа при этом отменяется.
 func (m *Metronome) SetBPM(bpm int) error {
 	if bpm < 20 || bpm > 300 {
 		return fmt.Errorf("BPM должен быть от 20 до 300")
 	}
 
 	m.mu.Lock()
-	wasRunning := m.Running
-	if wasRunning {
-		m.Stop()
-	}
+	defer m.mu.Unlock()
 
 	m.BPM = bpm
+	m.ramp = nil
+	if m.seq != nil {
+		m.seq.ramp = nil
+		m.seq.changeTempo(float64(bpm))
+	}
 
-	if wasRunning {
-		m.Start()
+	return nil
+}
+
+// RampTo плавно меняет темп по заданной кривой. Если метроном запущен,
+// переход начинается со следующей доли, иначе - с первой доли после Start.
+func (m *Metronome) RampTo(ramp TempoRamp) error {
+	if err := ramp.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ramp.From == 0 {
+		ramp.From = float64(m.BPM)
+		if m.seq != nil {
+			ramp.From = m.seq.tempo
+		}
+	}
+
+	m.BPM = int(math.Round(ramp.To))
+	if m.seq != nil {
+		m.seq.startRamp(ramp)
+	} else {
+		m.ramp = &ramp
 	}
-	m.mu.Unlock()
 
 	return nil
 }
 
-func (m *Metronome) SetPattern(pattern *Pattern) {
+// SetTimeSignature задает размер и счетную долю темпа. Нулевая счетная
+// доля означает долю по умолчанию для размера: четверть с точкой
+// в сложных размерах, иначе - одна пульсация.
+func (m *Metronome) SetTimeSignature(ts TimeSignature, beatUnit NoteValue) error {
+	if err := ts.Validate(); err != nil {
+		return err
+	}
+	if beatUnit < 0 {
+		return fmt.Errorf("счетная доля должна быть положительной")
+	}
+	if beatUnit == 0 {
+		beatUnit = ts.DefaultBeatUnit()
+	}
+
 	m.mu.Lock()
-	m.Pattern = pattern
-	m.mu.Unlock()
+	defer m.mu.Unlock()
+
+	m.TimeSignature = ts
+	m.BeatsPerBar = ts.Numerator
+	m.BeatUnit = beatUnit
+	if m.seq != nil {
+		m.seq.setMeter(ts, beatUnit)
+	}
+
+	return nil
+}
+
+// SetSubdivision делит каждую долю без собственного Subdiv на n равных
+// частей (2 - восьмые, 3 - триоли, 4 - шестнадцатые...). 0 или 1 - без
+// подразделений.
+func (m *Metronome) SetSubdivision(n int) error {
+	if err := ValidateSubdivision(n); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.subdivision = n
+	if m.seq != nil {
+		m.seq.subdivision = n
+	}
+
+	return nil
+}
+
+// SetTrainer включает тренажер скорости. Если метроном запущен, тренажер
+// начинает работу со следующего такта.
+func (m *Metronome) SetTrainer(cfg TrainerConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trainer = &cfg
+	m.BPM = cfg.Start
+	if m.seq != nil {
+		m.seq.trainer = newTrainerState(cfg)
+		m.seq.changeTempo(float64(cfg.Start))
+	}
+
+	return nil
 }
 
-func (m *Metronome) GetState() map[string]interface{} {
+// SetHumanize задает отклонения ударов от сетки, перекрывая настройки
+// паттерна. Если метроном запущен, они действуют со следующей доли.
+func (m *Metronome) SetHumanize(h Humanize) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	return map[string]interface{}{
-		"bpm":           m.BPM,
-		"beats_per_bar": m.BeatsPerBar,
-		"running":       m.Running,
-		"current_beat":  m.beatCount,
-		"current_bar":   m.barCount,
-		"pattern":       m.Pattern.Name,
+	m.humanize = &h
+	if m.seq != nil {
+		m.seq.humanize = newHumanizeState(&h)
+	}
+
+	return nil
+}
+
+// SetMuteRules задает правила приглушения долей поверх паттерна.
+// Если метроном запущен, правила действуют со следующей доли.
+func (m *Metronome) SetMuteRules(rules MuteRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mute = &rules
+	if m.seq != nil {
+		m.seq.mute = newMuteState(rules)
+	}
+
+	return nil
+}
+
+// SetCountIn задает отсчет перед первым тактом. Отсчет играется при
+// следующем запуске и в начале генерируемого WAV.
+func (m *Metronome) SetCountIn(c CountIn) error {
+	if err := c.Validate(); err != nil {
+		return err
 	}
+
+	m.mu.Lock()
+	m.countIn = c
+	m.mu.Unlock()
+
+	return nil
+}
+
+// NewSongMetronome создает метроном, играющий песню по разделам.
+// Песня должна быть разрешена через Song.Resolve.
+func NewSongMetronome(song *Song) (*Metronome, error) {
+	if len(song.Sections) == 0 || song.Sections[0].pattern == nil {
+		return nil, fmt.Errorf("песня не разрешена")
+	}
+
+	first := song.Sections[0]
+	m, err := NewMetronome(int(math.Round(first.tempo)), first.meter.Numerator, first.pattern)
+	if err != nil {
+		return nil, err
+	}
+	m.TimeSignature = first.meter
+	m.BeatUnit = first.beatUnit
+	m.song = song
+
+	return m, nil
+}
+
+func (m *Metronome) SetPattern(pattern *Pattern) {
+	m.mu.Lock()
+	m.Pattern = pattern
+	if m.seq != nil {
+		m.seq.pattern = pattern
+	}
+	m.mu.Unlock()
 }
 
 func (m *Metronome) Reset() {
 	m.mu.Lock()
 	m.beatCount = 0
 	m.barCount = 1
+	if m.seq != nil {
+		m.seq.resetCount()
+	}
 	m.mu.Unlock()
 }
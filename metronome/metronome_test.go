@@ -0,0 +1,384 @@
+package metronome
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// testStep - шаг, которым тесты двигают поддельные часы
+const testStep = 5 * time.Millisecond
+
+// tick - проверяемая часть TickEvent
+type tick struct {
+	Bar    int
+	Beat   int
+	Sound  string
+	Offset time.Duration
+}
+
+func ticks(events []TickEvent) []tick {
+	out := make([]tick, len(events))
+	for i, e := range events {
+		out[i] = tick{Bar: e.Bar, Beat: e.Beat, Sound: e.Sound, Offset: e.Offset}
+	}
+	return out
+}
+
+// newTestMetronome создает метроном без звука и вывода в консоль,
+// идущий по поддельным часам
+func newTestMetronome(t *testing.T, bpm, beats int, pattern string) (*Metronome, *FakeClock) {
+	t.Helper()
+
+	clock := NewFakeClock(testStart)
+	m, err := NewMetronomeWithClock(bpm, beats, PredefinedPatterns()[pattern], clock)
+	if err != nil {
+		t.Fatalf("NewMetronomeWithClock: %v", err)
+	}
+	m.out = nil
+	m.quiet = true
+	return m, clock
+}
+
+// collect двигает часы шагами testStep, пока не придет n событий.
+// Перед каждым шагом ждет, пока планировщик закончит проход.
+func collect[E any](t *testing.T, clock *FakeClock, events <-chan E, n int) []E {
+	t.Helper()
+
+	var got []E
+	for len(got) < n {
+		clock.BlockUntil(1)
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("канал событий закрыт после %d событий", len(got))
+			}
+			got = append(got, event)
+		default:
+			clock.Advance(testStep)
+		}
+	}
+	return got
+}
+
+func TestPatternCycle(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "rock")
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	got := collect(t, clock, events, 9)
+	want := []tick{
+		{1, 1, "accent", 0},
+		{1, 2, "normal", 500 * time.Millisecond},
+		{1, 3, "accent", 1000 * time.Millisecond},
+		{1, 4, "normal", 1500 * time.Millisecond},
+		{2, 1, "accent", 2000 * time.Millisecond},
+		{2, 2, "normal", 2500 * time.Millisecond},
+		{2, 3, "accent", 3000 * time.Millisecond},
+		{2, 4, "normal", 3500 * time.Millisecond},
+		{3, 1, "accent", 4000 * time.Millisecond},
+	}
+	if !slices.Equal(ticks(got), want) {
+		t.Errorf("последовательность долей:\n got %v\nwant %v", ticks(got), want)
+	}
+
+	for _, e := range got {
+		if want := testStart.Add(e.Offset); !e.Timestamp.Equal(want) {
+			t.Errorf("такт %d доля %d: Timestamp %v, ожидалось %v", e.Bar, e.Beat, e.Timestamp, want)
+		}
+	}
+}
+
+func TestCompoundMeterCycle(t *testing.T) {
+	// 6/8 с темпом 60 по четвертям с точкой: восьмая длится треть секунды
+	m, clock := newTestMetronome(t, 60, 6, "6-8")
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	got := collect(t, clock, events, 7)
+	wantSounds := []string{"accent", "ghost", "ghost", "normal", "ghost", "ghost", "accent"}
+	for i, e := range got {
+		if e.Sound != wantSounds[i] {
+			t.Errorf("событие %d: звук %q, ожидался %q", i, e.Sound, wantSounds[i])
+		}
+		wantOffset := samplesToDuration(int64(i * sampleRate / 3))
+		if e.Offset != wantOffset {
+			t.Errorf("событие %d: смещение %v, ожидалось %v", i, e.Offset, wantOffset)
+		}
+	}
+	if last := got[6]; last.Bar != 2 || last.Beat != 1 {
+		t.Errorf("седьмая доля: такт %d доля %d, ожидалось 2/1", last.Bar, last.Beat)
+	}
+}
+
+func TestTempoChange(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	before := collect(t, clock, events, 3)
+	if err := m.SetBPM(240); err != nil {
+		t.Fatalf("SetBPM: %v", err)
+	}
+	after := collect(t, clock, events, 3)
+
+	want := []tick{
+		{1, 1, "accent", 0},
+		{1, 2, "normal", 500 * time.Millisecond},
+		{1, 3, "normal", 1000 * time.Millisecond},
+		// Новый темп действует с доли, еще не запланированной до смены
+		{1, 4, "normal", 1500 * time.Millisecond},
+		{2, 1, "accent", 1750 * time.Millisecond},
+		{2, 2, "normal", 2000 * time.Millisecond},
+	}
+	if got := ticks(append(before, after...)); !slices.Equal(got, want) {
+		t.Errorf("последовательность долей:\n got %v\nwant %v", got, want)
+	}
+
+	for i, e := range after {
+		if e.Tempo != 240 {
+			t.Errorf("доля %d после смены: темп %v, ожидался 240", i+1, e.Tempo)
+		}
+		if e.TempoChanged != (i == 0) {
+			t.Errorf("доля %d после смены: TempoChanged = %v", i+1, e.TempoChanged)
+		}
+	}
+}
+
+func TestStopAndRestart(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	collect(t, clock, events, 3)
+
+	m.Stop()
+	select {
+	case <-m.Done():
+	default:
+		t.Fatal("Done не закрыт после Stop")
+	}
+	if m.Transport() != TransportStopped {
+		t.Errorf("состояние %v, ожидалось stopped", m.Transport())
+	}
+	// Канал Subscribe закрывается при остановке: range по нему завершается
+	for range events {
+	}
+	clock.BlockUntil(0)
+
+	clock.Advance(3 * time.Second)
+	restart := clock.Now()
+	events = m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("повторный Play: %v", err)
+	}
+	defer m.Stop()
+
+	// Счет после перезапуска начинается заново
+	got := collect(t, clock, events, 2)
+	want := []tick{
+		{1, 1, "accent", 0},
+		{1, 2, "normal", 500 * time.Millisecond},
+	}
+	if !slices.Equal(ticks(got), want) {
+		t.Errorf("после перезапуска:\n got %v\nwant %v", ticks(got), want)
+	}
+	if !got[0].Timestamp.Equal(restart) {
+		t.Errorf("первая доля после перезапуска в %v, ожидалось %v", got[0].Timestamp, restart)
+	}
+	select {
+	case <-m.Done():
+		t.Error("Done закрыт у снова запущенного метронома")
+	default:
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	before := collect(t, clock, events, 2)
+	if err := m.Pause(); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	clock.BlockUntil(0)
+	clock.Advance(10 * time.Second)
+
+	if err := m.Resume(); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	after := collect(t, clock, events, 2)
+
+	want := []tick{
+		{1, 1, "accent", 0},
+		{1, 2, "normal", 500 * time.Millisecond},
+		{1, 3, "normal", 1000 * time.Millisecond},
+		{1, 4, "normal", 1500 * time.Millisecond},
+	}
+	if got := ticks(append(before, after...)); !slices.Equal(got, want) {
+		t.Errorf("последовательность долей:\n got %v\nwant %v", got, want)
+	}
+
+	// Пауза сдвигает время звучания, но не позицию на шкале
+	if gap := after[0].Timestamp.Sub(before[1].Timestamp); gap < 10*time.Second {
+		t.Errorf("интервал через паузу %v, ожидалось не меньше 10s", gap)
+	}
+	if gap := after[1].Timestamp.Sub(after[0].Timestamp); gap != 500*time.Millisecond {
+		t.Errorf("интервал после паузы %v, ожидалось 500ms", gap)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	events := m.Subscribe()
+
+	if err := m.Seek(3, 2); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	got := collect(t, clock, events, 4)
+	want := []tick{
+		{3, 2, "normal", 4500 * time.Millisecond},
+		{3, 3, "normal", 5000 * time.Millisecond},
+		{3, 4, "normal", 5500 * time.Millisecond},
+		{4, 1, "accent", 6000 * time.Millisecond},
+	}
+	if !slices.Equal(ticks(got), want) {
+		t.Errorf("после Seek:\n got %v\nwant %v", ticks(got), want)
+	}
+	if !got[0].Timestamp.Equal(testStart) {
+		t.Errorf("первая доля после Seek в %v, ожидалось %v", got[0].Timestamp, testStart)
+	}
+
+	// Переход во время игры продолжает с новой позиции
+	if err := m.Seek(1, 1); err != nil {
+		t.Fatalf("Seek во время игры: %v", err)
+	}
+	got = collect(t, clock, events, 2)
+	want = []tick{
+		{1, 1, "accent", 0},
+		{1, 2, "normal", 500 * time.Millisecond},
+	}
+	if !slices.Equal(ticks(got), want) {
+		t.Errorf("после Seek во время игры:\n got %v\nwant %v", ticks(got), want)
+	}
+}
+
+func TestSeekOutOfRange(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+
+	for _, pos := range [][2]int{{0, 1}, {1, 0}, {2, 5}} {
+		if err := m.Seek(pos[0], pos[1]); err == nil {
+			t.Errorf("Seek(%d, %d) должен вернуть ошибку", pos[0], pos[1])
+		}
+	}
+}
+
+func TestSongPlaysSectionsAndStops(t *testing.T) {
+	song := &Song{
+		Name: "test",
+		BPM:  120,
+		Sections: []Section{
+			{Name: "verse", Bars: 1, Pattern: "waltz"},
+			{Name: "chorus", Bars: 1, Pattern: "basic"},
+		},
+	}
+	lookup := func(name string) (*Pattern, error) {
+		return PredefinedPatterns()[name], nil
+	}
+	if err := song.Resolve(lookup); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	m, err := NewSongMetronome(song)
+	if err != nil {
+		t.Fatalf("NewSongMetronome: %v", err)
+	}
+	clock := NewFakeClock(testStart)
+	m.clock = clock
+	m.out = nil
+	m.quiet = true
+
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+
+	var got []TickEvent
+	for len(got) < 7 {
+		select {
+		case e := <-events:
+			got = append(got, e)
+			continue
+		default:
+		}
+		clock.Advance(testStep)
+	}
+
+	want := []tick{
+		{1, 1, "accent", 0},
+		{1, 2, "normal", 500 * time.Millisecond},
+		{1, 3, "normal", 1000 * time.Millisecond},
+		{2, 1, "accent", 1500 * time.Millisecond},
+		{2, 2, "normal", 2000 * time.Millisecond},
+		{2, 3, "normal", 2500 * time.Millisecond},
+		{2, 4, "normal", 3000 * time.Millisecond},
+	}
+	if !slices.Equal(ticks(got), want) {
+		t.Errorf("песня:\n got %v\nwant %v", ticks(got), want)
+	}
+	if got[0].Section != "verse" || got[3].Section != "chorus" || !got[3].SectionChanged {
+		t.Errorf("разделы: %q, %q (смена %v)", got[0].Section, got[3].Section, got[3].SectionChanged)
+	}
+
+	// Последняя доля разослана - метроном останавливается сам
+	select {
+	case <-m.Done():
+	case <-time.After(time.Second):
+		t.Fatal("метроном не остановился в конце песни")
+	}
+}
+
+func TestSetBPMDuringTransportChanges(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			m.Play()
+			m.Pause()
+			m.Resume()
+			m.Stop()
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		m.SetBPM(60 + i%100)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("взаимная блокировка при смене темпа во время Play/Stop")
+	}
+}
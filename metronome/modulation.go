@@ -0,0 +1,97 @@
+package metronome
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// MetricModulation - метрическая модуляция "новая New = старая Old":
+// длительность New в новом темпе равна длительности Old в старом.
+// Например, "4=4." (новая четверть = старая четверть с точкой) замедляет
+// темп в полтора раза, а "8=8t" (триольная восьмая становится новой
+// восьмой) ускоряет.
+type MetricModulation struct {
+	New NoteValue `json:"new"`
+	Old NoteValue `json:"old"`
+}
+
+// ParseMetricModulation разбирает модуляцию в записи "новая=старая",
+// например "4=4." или "8=8t"
+func ParseMetricModulation(s string) (MetricModulation, error) {
+	newStr, oldStr, ok := strings.Cut(s, "=")
+	if !ok {
+		return MetricModulation{}, fmt.Errorf("модуляция должна быть вида \"4=4.\" (новая = старая), получено '%s'", s)
+	}
+
+	newValue, err := ParseNoteValue(newStr)
+	if err != nil {
+		return MetricModulation{}, fmt.Errorf("модуляция '%s': %w", s, err)
+	}
+	oldValue, err := ParseNoteValue(oldStr)
+	if err != nil {
+		return MetricModulation{}, fmt.Errorf("модуляция '%s': %w", s, err)
+	}
+
+	return MetricModulation{New: newValue, Old: oldValue}, nil
+}
+
+func (mm MetricModulation) String() string {
+	return mm.New.String() + "=" + mm.Old.String()
+}
+
+// Validate проверяет длительности модуляции
+func (mm MetricModulation) Validate() error {
+	if mm.New <= 0 || mm.Old <= 0 {
+		return fmt.Errorf("длительности модуляции должны быть положительными")
+	}
+	return nil
+}
+
+// NextTempo возвращает темп после модуляции. Темпы заданы каждый в своей
+// счетной доле: tempo - в oldUnit, результат - в newUnit.
+func (mm MetricModulation) NextTempo(tempo float64, oldUnit, newUnit NoteValue) float64 {
+	return tempo * float64(mm.New) / float64(mm.Old) * float64(oldUnit) / float64(newUnit)
+}
+
+// validModulatedTempo проверяет, что темп после модуляции в рабочем диапазоне
+func validModulatedTempo(mm MetricModulation, tempo float64) error {
+	if tempo < 20 || tempo > 300 {
+		return fmt.Errorf("модуляция %s дает %.1f BPM, а темп должен быть от 20 до 300", mm, tempo)
+	}
+	return nil
+}
+
+// Modulate выполняет метрическую модуляцию с ближайшей тактовой черты.
+// Счетная доля не меняется, меняется только темп; активный переход
+// темпа отменяется. У остановленного метронома темп меняется сразу.
+func (m *Metronome) Modulate(mm MetricModulation) error {
+	if err := mm.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seq == nil {
+		tempo := mm.NextTempo(float64(m.BPM), m.BeatUnit, m.BeatUnit)
+		if err := validModulatedTempo(mm, tempo); err != nil {
+			return err
+		}
+		m.BPM = int(math.Round(tempo))
+		m.ramp = nil
+		return nil
+	}
+
+	if m.seq.modulation != nil {
+		return fmt.Errorf("модуляция %s уже ждет тактовой черты", m.seq.modulation)
+	}
+	tempo := mm.NextTempo(m.seq.tempo, m.seq.beatUnit, m.seq.beatUnit)
+	if err := validModulatedTempo(mm, tempo); err != nil {
+		return err
+	}
+	m.seq.modulation = &mm
+	m.ramp = nil
+
+	return nil
+}
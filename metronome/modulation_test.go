@@ -0,0 +1,106 @@
+package metronome
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseMetricModulation(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64 // Темп после модуляции от 120
+	}{
+		{"4=4.", 80},  // Новая четверть = старая четверть с точкой
+		{"4.=4", 180}, // Новая четверть с точкой = старая четверть
+		{"8=8t", 180}, // Триольная восьмая становится новой восьмой
+		{"2=4", 240},  // Половинная = старая четверть
+	}
+	for _, tt := range tests {
+		mm, err := ParseMetricModulation(tt.in)
+		if err != nil {
+			t.Fatalf("ParseMetricModulation(%q): %v", tt.in, err)
+		}
+		if mm.String() != tt.in {
+			t.Errorf("String() = %q, ожидалось %q", mm, tt.in)
+		}
+		if got := mm.NextTempo(120, Quarter, Quarter); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: темп %.2f, ожидалось %.2f", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"4", "4=", "3=4", "4=4=4"} {
+		if _, err := ParseMetricModulation(bad); err == nil {
+			t.Errorf("ParseMetricModulation(%q) должен вернуть ошибку", bad)
+		}
+	}
+}
+
+func TestModulateAtNextBar(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub := m.SubscribeEvents(ctx, OnlyKinds(KindBeat, KindModulated))
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	// Модуляция посреди первого такта срабатывает только со второго
+	collect(t, clock, sub.Events(), 2)
+	if err := m.Modulate(MetricModulation{New: Quarter, Old: Quarter * 1.5}); err != nil {
+		t.Fatalf("Modulate: %v", err)
+	}
+	if err := m.Modulate(MetricModulation{New: Quarter, Old: Eighth}); err == nil {
+		t.Error("вторая модуляция до тактовой черты должна быть отклонена")
+	}
+
+	got := collect(t, clock, sub.Events(), 5)
+	for _, e := range got[:2] {
+		if beat := e.(BeatEvent); beat.Bar != 1 || beat.Tempo != 120 {
+			t.Errorf("до черты: такт %d, темп %.1f", beat.Bar, beat.Tempo)
+		}
+	}
+	mod, ok := got[2].(Modulated)
+	if !ok || mod.Bar != 2 || mod.From != 120 || mod.To != 80 {
+		t.Fatalf("ожидалось Modulated 120 → 80 на такте 2, получено %#v", got[2])
+	}
+	first, second := got[3].(BeatEvent), got[4].(BeatEvent)
+	if first.Offset != 2*time.Second || first.Modulation == nil {
+		t.Errorf("первая доля после модуляции: %v, Modulation %v", first.Offset, first.Modulation)
+	}
+	if d := second.Offset - first.Offset; d != 750*time.Millisecond {
+		t.Errorf("интервал после модуляции %v, ожидалось 750ms", d)
+	}
+	if m.BPM != 80 {
+		t.Errorf("BPM = %d, ожидалось 80", m.BPM)
+	}
+}
+
+func TestSongSectionModulation(t *testing.T) {
+	song := &Song{
+		BPM: 120,
+		Sections: []Section{
+			{Name: "verse", Bars: 2},
+			{Name: "swing", Bars: 2, Time: "6/8", Modulation: "4.=4"},
+			{Name: "half", Bars: 2, Modulation: "4=4."},
+		},
+	}
+	if err := song.Resolve(testLookup); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+
+	// Четверть с точкой в 6/8 равна прежней четверти: 120 по четвертям с точкой,
+	// а затем новая четверть равна старой с точкой - снова 120
+	for i, want := range []float64{120, 120, 120} {
+		if got := song.Sections[i].tempo; math.Abs(got-want) > 1e-9 {
+			t.Errorf("раздел %d: темп %.2f, ожидалось %.2f", i, got, want)
+		}
+	}
+
+	bad := &Song{Sections: []Section{{Name: "intro", Bars: 1, Modulation: "4=4."}}}
+	if err := bad.Resolve(testLookup); err == nil {
+		t.Error("модуляция в первом разделе должна быть отклонена")
+	}
+}
@@ -0,0 +1,64 @@
+package metronome
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// MuteRules - правила приглушения долей поверх любого паттерна. Приглушенные
+// доли не звучат, но счет долей и тактов продолжается, а подписчики
+// по-прежнему получают их с флагом Muted - так музыкант может проверить,
+// куда он попал без щелчка.
+type MuteRules struct {
+	PlayBars    int     // Тактов со звуком (тренировка внутренних часов)
+	MuteBars    int     // Тактов тишины после них; 0 - без пауз
+	Probability float64 // Вероятность заглушить отдельную долю (0.0-1.0)
+	Seed        int64   // Зерно случайного выбора; 0 - случайное
+}
+
+// Validate проверяет правила приглушения
+func (r MuteRules) Validate() error {
+	if r.PlayBars < 0 || r.MuteBars < 0 {
+		return fmt.Errorf("количество тактов не может быть отрицательным")
+	}
+	if r.MuteBars > 0 && r.PlayBars == 0 {
+		return fmt.Errorf("укажите, сколько тактов играть перед паузой")
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("вероятность приглушения должна быть от 0 до 1")
+	}
+	return nil
+}
+
+// muteState применяет правила приглушения внутри секвенсора
+type muteState struct {
+	rules MuteRules
+	rng   *rand.Rand
+}
+
+func newMuteState(rules MuteRules) *muteState {
+	seed := rules.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &muteState{
+		rules: rules,
+		rng:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// muted решает, звучит ли доля в такте bar. Случайное число берется для
+// каждой доли, даже в тихих тактах, чтобы последовательность при одном
+// и том же зерне не зависела от длины пауз.
+func (m *muteState) muted(bar int) bool {
+	random := m.rules.Probability > 0 && m.rng.Float64() < m.rules.Probability
+
+	if m.rules.MuteBars > 0 {
+		pos := (bar - 1) % (m.rules.PlayBars + m.rules.MuteBars)
+		if pos >= m.rules.PlayBars {
+			return true
+		}
+	}
+	return random
+}
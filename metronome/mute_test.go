@@ -0,0 +1,85 @@
+package metronome
+
+import (
+	"slices"
+	"testing"
+)
+
+// mutedBeats возвращает признак Muted для первых n долей метронома
+// с правилами rules
+func mutedBeats(t *testing.T, rules MuteRules, n int) []bool {
+	t.Helper()
+
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetMuteRules(rules); err != nil {
+		t.Fatalf("SetMuteRules: %v", err)
+	}
+
+	seq := m.newSequencer()
+	muted := make([]bool, n)
+	for i := range muted {
+		e := seq.next()
+		muted[i] = e.Muted
+		if e.Muted && e.Audible() {
+			t.Errorf("доля %d приглушена, но звучит", i+1)
+		}
+	}
+	return muted
+}
+
+func TestMuteGapBars(t *testing.T) {
+	// Два такта со звуком, один без: такты 3 и 6 тихие
+	muted := mutedBeats(t, MuteRules{PlayBars: 2, MuteBars: 1}, 24)
+	for i, got := range muted {
+		bar := i/4 + 1
+		if want := bar%3 == 0; got != want {
+			t.Errorf("такт %d, доля %d: Muted = %v, ожидалось %v", bar, i%4+1, got, want)
+		}
+	}
+}
+
+func TestMuteProbabilitySeeded(t *testing.T) {
+	rules := MuteRules{Probability: 0.5, Seed: 42}
+	first := mutedBeats(t, rules, 64)
+	if again := mutedBeats(t, rules, 64); !slices.Equal(first, again) {
+		t.Errorf("при одном зерне приглушены разные доли:\n%v\n%v", first, again)
+	}
+
+	silent := 0
+	for _, m := range first {
+		if m {
+			silent++
+		}
+	}
+	if silent == 0 || silent == len(first) {
+		t.Errorf("при вероятности 0.5 приглушено %d долей из %d", silent, len(first))
+	}
+
+	rules.Seed = 7
+	if other := mutedBeats(t, rules, 64); slices.Equal(first, other) {
+		t.Errorf("другое зерно дало ту же последовательность")
+	}
+}
+
+func TestMuteProbabilityIndependentOfGaps(t *testing.T) {
+	// Случайный выбор не зависит от пауз: вне тихих тактов доли те же
+	random := mutedBeats(t, MuteRules{Probability: 0.3, Seed: 5}, 24)
+	gaps := mutedBeats(t, MuteRules{PlayBars: 1, MuteBars: 1, Probability: 0.3, Seed: 5}, 24)
+	for i := range random {
+		if bar := i/4 + 1; bar%2 == 1 && gaps[i] != random[i] {
+			t.Errorf("такт %d, доля %d: %v с паузами, %v без", bar, i%4+1, gaps[i], random[i])
+		}
+	}
+}
+
+func TestMuteRulesValidate(t *testing.T) {
+	for _, bad := range []MuteRules{
+		{PlayBars: -1},
+		{MuteBars: 2},
+		{Probability: 1.5},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) должен вернуть ошибку", bad)
+		}
+	}
+}
@@ -3,16 +3,33 @@ package metronome
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 )
 
 type Pattern struct {
 	Name        string           `json:"name"`
 	Description string           `json:"description"`
 	Beats       int              `json:"beats"`
-	Pattern     []BeatDefinition `json:"pattern"`
-	Cycle       int              `json:"cycle"` // Цикл повторения (в тактах)
+	Meter       string           `json:"meter,omitempty"`     // Размер, например "6/8"; по умолчанию Beats/4
+	Grouping    string           `json:"grouping,omitempty"`  // Группировка, например "3+2+2/8"
+	BeatUnit    string           `json:"beat_unit,omitempty"` // Счетная доля темпа, например "4."
+	Pattern     []BeatDefinition `json:"pattern"`             // Такт по умолчанию
+	Bars        []BarDefinition  `json:"bars,omitempty"`      // Отдельные такты цикла
+	Cycle       int              `json:"cycle"`               // Цикл повторения (в тактах)
+
+	// Звуки уровней подразделения (ключ: 2 - восьмые, 3 - триоли...)
+	Subdivisions map[int]SubdivisionVoice `json:"subdivisions,omitempty"`
+	// Независимые голоса полиритмии поверх основных долей
+	Layers []Layer `json:"layers,omitempty"`
+	// Отклонения ударов от сетки; настройки метронома важнее
+	Humanize *Humanize `json:"humanize,omitempty"`
+	// Зерно вероятностных условий долей; 0 - случайное
+	Seed int64 `json:"seed,omitempty"`
+	// Сбивка, периодически заменяющая такт паттерна
+	Fill *Fill `json:"fill,omitempty"`
 }
 
 type BeatDefinition struct {
@@ -22,40 +39,159 @@ type BeatDefinition struct {
 	Subdiv  int     `json:"subdiv"`  // Подразделения (триоли и т.д.)
 	Accent  bool    `json:"accent"`  // Акцент
 	Comment string  `json:"comment"` // Комментарий для музыканта
+
+	// Условие срабатывания, например "60%" или "!last" (см. TrigCondition)
+	Condition string `json:"condition,omitempty"`
+}
+
+// BarDefinition - такт цикла со своими долями. Доли, которых в нем нет,
+// наследуются из такта по умолчанию (Pattern.Pattern), если не задан
+// Replace.
+type BarDefinition struct {
+	Bar     int              `json:"bar"`               // Номер такта в цикле (1-based)
+	Pattern []BeatDefinition `json:"pattern"`           // Доли этого такта
+	Replace bool             `json:"replace,omitempty"` // Не наследовать доли такта по умолчанию
+	Comment string           `json:"comment,omitempty"` // Комментарий для музыканта
+}
+
+// Clone возвращает глубокую копию паттерна: ее можно менять и разрешать,
+// не затрагивая оригинал
+func (p *Pattern) Clone() *Pattern {
+	c := *p
+	c.Pattern = slices.Clone(p.Pattern)
+	c.Bars = slices.Clone(p.Bars)
+	for i := range c.Bars {
+		c.Bars[i].Pattern = slices.Clone(c.Bars[i].Pattern)
+	}
+	c.Subdivisions = maps.Clone(p.Subdivisions)
+	c.Layers = slices.Clone(p.Layers)
+	if p.Humanize != nil {
+		h := *p.Humanize
+		c.Humanize = &h
+	}
+	if p.Fill != nil {
+		f := *p.Fill
+		c.Fill = &f
+	}
+	return &c
+}
+
+// CycleLength возвращает длину цикла в тактах: Cycle, а если он не задан -
+// номер последнего такта из Bars. 0 - паттерн не циклический.
+func (p *Pattern) CycleLength() int {
+	if p.Cycle > 0 {
+		return p.Cycle
+	}
+	length := 0
+	for _, bar := range p.Bars {
+		length = max(length, bar.Bar)
+	}
+	return length
 }
 
 func (p *Pattern) GetSound(beat, bar int) (string, float64) {
+	def := p.Lookup(beat, bar)
+	return def.Sound, def.Volume
+}
+
+// Lookup возвращает определение доли beat в такте bar. Доля ищется в
+// такте цикла, затем в такте по умолчанию.
+func (p *Pattern) Lookup(beat, bar int) BeatDefinition {
 	// Если паттерн циклический, вычисляем позицию в цикле
-	if p.Cycle > 0 {
-		bar = ((bar - 1) % p.Cycle) + 1
+	if cycle := p.CycleLength(); cycle > 0 {
+		bar = ((bar - 1) % cycle) + 1
 	}
 
-	// Ищем определение для этой доли
-	for _, def := range p.Pattern {
-		if def.Beat == beat {
-			// Проверяем, применяется ли этот паттерн к текущему такту
-			// (простейшая реализация)
-			return def.Sound, def.Volume
+	inherit := true
+	for _, bd := range p.Bars {
+		if bd.Bar != bar {
+			continue
+		}
+		if def, ok := findBeat(bd.Pattern, beat); ok {
+			return def
+		}
+		inherit = !bd.Replace
+		break
+	}
+
+	if inherit {
+		// Старая запись: доли следующих тактов цикла нумеруются подряд,
+		// например 5-8 для второго такта при Beats: 4
+		if bar > 1 && p.Beats > 0 {
+			if def, ok := findBeat(p.Pattern, (bar-1)*p.Beats+beat); ok {
+				def.Beat = beat
+				return def
+			}
+		}
+		if def, ok := findBeat(p.Pattern, beat); ok {
+			return def
 		}
 	}
 
+	// Доли без определения получают акценты по группировке
+	if g := p.BeatGrouping(); g != nil {
+		return g.Definition(beat)
+	}
+
 	// По умолчанию - обычный удар
-	return "normal", 0.7
+	return BeatDefinition{Beat: beat, Sound: "normal", Volume: 0.7}
 }
 
-// LoadPatternFromFile загружает паттерн из JSON файла
+// findBeat ищет определение доли beat
+func findBeat(defs []BeatDefinition, beat int) (BeatDefinition, bool) {
+	for _, def := range defs {
+		if def.Beat == beat {
+			return def, true
+		}
+	}
+	return BeatDefinition{}, false
+}
+
+// TimeSignature возвращает размер паттерна: из Meter, затем из Grouping,
+// а если ни то ни другое не задано - Beats четвертей
+func (p *Pattern) TimeSignature() TimeSignature {
+	if p.Meter != "" {
+		if ts, err := ParseTimeSignature(p.Meter); err == nil {
+			return ts
+		}
+	}
+	if g := p.BeatGrouping(); g != nil {
+		return g.Meter()
+	}
+	if p.Beats > 0 {
+		return CommonTime(p.Beats)
+	}
+	return CommonTime(4)
+}
+
+// DefaultBeatUnit возвращает счетную долю паттерна: из BeatUnit,
+// а если она не задана - по размеру. Размер с группировкой считается
+// ее пульсациями
+func (p *Pattern) DefaultBeatUnit() NoteValue {
+	if p.BeatUnit != "" {
+		if unit, err := ParseNoteValue(p.BeatUnit); err == nil {
+			return unit
+		}
+	}
+	if g := p.BeatGrouping(); g != nil && g.Meter() == p.TimeSignature() {
+		return g.BeatUnit()
+	}
+	return p.TimeSignature().DefaultBeatUnit()
+}
+
+// LoadPatternFromFile загружает и проверяет паттерн из JSON файла
 func LoadPatternFromFile(filename string) (*Pattern, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
 	}
 
-	var pattern Pattern
-	if err := json.Unmarshal(data, &pattern); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	pattern, err := ParsePattern(data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка в паттерне %s: %w", filepath.Base(filename), err)
 	}
 
-	return &pattern, nil
+	return pattern, nil
 }
 
 // SavePatternToFile сохраняет паттерн в JSON файл
@@ -103,6 +239,17 @@ func PredefinedPatterns() map[string]*Pattern {
 				{Beat: 4, Sound: "normal", Volume: 0.8, Accent: true, Comment: "Малый барабан"},
 			},
 		},
+		"rock-fill": {
+			Name:        "rock-fill",
+			Description: "Сбивка для рока: восьмые, затем шестнадцатые",
+			Beats:       4,
+			Pattern: []BeatDefinition{
+				{Beat: 1, Sound: "accent", Volume: 1.0, Accent: true, Subdiv: 2},
+				{Beat: 2, Sound: "normal", Volume: 0.8, Subdiv: 2},
+				{Beat: 3, Sound: "normal", Volume: 0.9, Subdiv: 4},
+				{Beat: 4, Sound: "accent", Volume: 1.0, Accent: true, Subdiv: 4, Comment: "Разгон к тарелке"},
+			},
+		},
 		"jazz": {
 			Name:        "jazz",
 			Description: "Джазовый паттерн ride-тарелки",
@@ -118,6 +265,7 @@ func PredefinedPatterns() map[string]*Pattern {
 			Name:        "waltz",
 			Description: "Вальс 3/4",
 			Beats:       3,
+			Meter:       "3/4",
 			Pattern: []BeatDefinition{
 				{Beat: 1, Sound: "accent", Volume: 1.0, Accent: true},
 				{Beat: 2, Sound: "normal", Volume: 0.6},
@@ -130,22 +278,24 @@ func PredefinedPatterns() map[string]*Pattern {
 			Beats:       4,
 			Cycle:       2, // Двухтактный паттерн
 			Pattern: []BeatDefinition{
-				// Первый такт
 				{Beat: 1, Sound: "accent", Volume: 1.0, Comment: "Downbeat"},
 				{Beat: 2, Sound: "ghost", Volume: 0.3, Comment: "Ghost note"},
 				{Beat: 3, Sound: "normal", Volume: 0.7, Comment: "Backbeat"},
 				{Beat: 4, Sound: "ghost", Volume: 0.3},
-				// Второй такт
-				{Beat: 5, Sound: "accent", Volume: 0.9},
-				{Beat: 6, Sound: "ghost", Volume: 0.3},
-				{Beat: 7, Sound: "normal", Volume: 0.8},
-				{Beat: 8, Sound: "ghost", Volume: 0.3},
+			},
+			Bars: []BarDefinition{
+				// Второй такт отличается первой и третьей долями, призраки наследуются
+				{Bar: 2, Pattern: []BeatDefinition{
+					{Beat: 1, Sound: "accent", Volume: 0.9},
+					{Beat: 3, Sound: "normal", Volume: 0.8},
+				}},
 			},
 		},
 		"5-4": {
 			Name:        "5-4",
 			Description: "Сложный размер 5/4",
 			Beats:       5,
+			Meter:       "5/4",
 			Pattern: []BeatDefinition{
 				{Beat: 1, Sound: "accent", Volume: 1.0},
 				{Beat: 2, Sound: "normal", Volume: 0.6},
@@ -158,31 +308,90 @@ func PredefinedPatterns() map[string]*Pattern {
 			Name:        "7-8",
 			Description: "Сложный размер 7/8 (3+2+2)",
 			Beats:       7,
+			Meter:       "7/8",
+			Grouping:    "3+2+2/8",
+		},
+		"6-8": {
+			Name:        "6-8",
+			Description: "Сложный размер 6/8, счет четвертями с точкой",
+			Beats:       6,
+			Meter:       "6/8",
+			Pattern: []BeatDefinition{
+				{Beat: 1, Sound: "accent", Volume: 1.0, Comment: "Первая счетная доля"},
+				{Beat: 2, Sound: "ghost", Volume: 0.4},
+				{Beat: 3, Sound: "ghost", Volume: 0.4},
+				{Beat: 4, Sound: "normal", Volume: 0.8, Comment: "Вторая счетная доля"},
+				{Beat: 5, Sound: "ghost", Volume: 0.4},
+				{Beat: 6, Sound: "ghost", Volume: 0.4},
+			},
+		},
+		"12-8": {
+			Name:        "12-8",
+			Description: "Блюзовый размер 12/8",
+			Beats:       12,
+			Meter:       "12/8",
 			Pattern: []BeatDefinition{
 				{Beat: 1, Sound: "accent", Volume: 1.0},
-				{Beat: 2, Sound: "normal", Volume: 0.6},
-				{Beat: 3, Sound: "normal", Volume: 0.6},
-				{Beat: 4, Sound: "accent", Volume: 0.8},
-				{Beat: 5, Sound: "normal", Volume: 0.6},
-				{Beat: 6, Sound: "accent", Volume: 0.8},
-				{Beat: 7, Sound: "normal", Volume: 0.6},
+				{Beat: 2, Sound: "ghost", Volume: 0.4},
+				{Beat: 3, Sound: "ghost", Volume: 0.4},
+				{Beat: 4, Sound: "normal", Volume: 0.8},
+				{Beat: 5, Sound: "ghost", Volume: 0.4},
+				{Beat: 6, Sound: "ghost", Volume: 0.4},
+				{Beat: 7, Sound: "normal", Volume: 0.9},
+				{Beat: 8, Sound: "ghost", Volume: 0.4},
+				{Beat: 9, Sound: "ghost", Volume: 0.4},
+				{Beat: 10, Sound: "normal", Volume: 0.8},
+				{Beat: 11, Sound: "ghost", Volume: 0.4},
+				{Beat: 12, Sound: "ghost", Volume: 0.4},
 			},
 		},
 		"poly": {
 			Name:        "poly",
 			Description: "Полиритмия 3:4",
-			Beats:       12, // НОК(3, 4)
+			Beats:       4,
+			Meter:       "4/4",
+			Pattern: []BeatDefinition{
+				{Beat: 1, Sound: "ride", Volume: 0.7, Comment: "4 - доля 1"},
+				{Beat: 2, Sound: "ride", Volume: 0.5, Comment: "4 - доля 2"},
+				{Beat: 3, Sound: "ride", Volume: 0.5, Comment: "4 - доля 3"},
+				{Beat: 4, Sound: "ride", Volume: 0.5, Comment: "4 - доля 4"},
+			},
+			Layers: []Layer{
+				{Name: "3", Pulses: 3, Sound: "accent", Volume: 0.8},
+			},
+		},
+		"poly-5-4": {
+			Name:        "poly-5-4",
+			Description: "Полиритмия 5:4",
+			Beats:       4,
+			Meter:       "4/4",
+			Pattern: []BeatDefinition{
+				{Beat: 1, Sound: "ride", Volume: 0.7},
+				{Beat: 2, Sound: "ride", Volume: 0.5},
+				{Beat: 3, Sound: "ride", Volume: 0.5},
+				{Beat: 4, Sound: "ride", Volume: 0.5},
+			},
+			Layers: []Layer{
+				{Name: "5", Pulses: 5, Sound: "accent", Volume: 0.8},
+			},
+		},
+		"poly-7-8": {
+			Name:        "poly-7-8",
+			Description: "Полиритмия 7:8",
+			Beats:       8,
+			Meter:       "8/8",
 			Pattern: []BeatDefinition{
-				// Ритм 3 поверх 4
-				{Beat: 1, Sound: "accent", Volume: 1.0, Comment: "3/4 - доля 1"},
-				{Beat: 4, Sound: "accent", Volume: 0.8, Comment: "3/4 - доля 2"},
-				{Beat: 7, Sound: "accent", Volume: 0.8, Comment: "3/4 - доля 3"},
-				{Beat: 10, Sound: "accent", Volume: 0.8, Comment: "3/4 - доля 1 следующего цикла"},
-				// Ритм 4 поверх 3
-				{Beat: 1, Sound: "ride", Volume: 0.6, Comment: "4/4 - доля 1"},
-				{Beat: 4, Sound: "ride", Volume: 0.5, Comment: "4/4 - доля 2"},
-				{Beat: 7, Sound: "ride", Volume: 0.5, Comment: "4/4 - доля 3"},
-				{Beat: 10, Sound: "ride", Volume: 0.5, Comment: "4/4 - доля 4"},
+				{Beat: 1, Sound: "ride", Volume: 0.7},
+				{Beat: 2, Sound: "ride", Volume: 0.4},
+				{Beat: 3, Sound: "ride", Volume: 0.5},
+				{Beat: 4, Sound: "ride", Volume: 0.4},
+				{Beat: 5, Sound: "ride", Volume: 0.6},
+				{Beat: 6, Sound: "ride", Volume: 0.4},
+				{Beat: 7, Sound: "ride", Volume: 0.5},
+				{Beat: 8, Sound: "ride", Volume: 0.4},
+			},
+			Layers: []Layer{
+				{Name: "7", Pulses: 7, Sound: "accent", Volume: 0.8},
 			},
 		},
 	}
@@ -0,0 +1,72 @@
+package metronome
+
+import "testing"
+
+func TestPatternBarCycle(t *testing.T) {
+	pat := PredefinedPatterns()["shuffle"]
+
+	volumes := func(bar int) []float64 {
+		var out []float64
+		for beat := 1; beat <= 4; beat++ {
+			out = append(out, pat.Lookup(beat, bar).Volume)
+		}
+		return out
+	}
+	// Второй такт меняет первую и третью доли, призраки наследуются;
+	// третий такт - снова первый такт цикла
+	for bar, want := range map[int][]float64{1: {1.0, 0.3, 0.7, 0.3}, 2: {0.9, 0.3, 0.8, 0.3}, 3: {1.0, 0.3, 0.7, 0.3}} {
+		got := volumes(bar)
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("такт %d: громкости %v, ожидалось %v", bar, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestPatternBarReplace(t *testing.T) {
+	pat := &Pattern{
+		Beats:   4,
+		Pattern: []BeatDefinition{{Beat: 1, Sound: "accent", Volume: 1.0}, {Beat: 2, Sound: "ghost", Volume: 0.3}},
+		Bars:    []BarDefinition{{Bar: 2, Replace: true, Pattern: []BeatDefinition{{Beat: 1, Sound: "ride", Volume: 0.8}}}},
+	}
+	if pat.CycleLength() != 2 {
+		t.Errorf("длина цикла %d, ожидалось 2", pat.CycleLength())
+	}
+	if def := pat.Lookup(1, 2); def.Sound != "ride" {
+		t.Errorf("доля 1 такта 2: %q, ожидалось ride", def.Sound)
+	}
+	// Replace: вторая доля не наследуется из такта по умолчанию
+	if def := pat.Lookup(2, 2); def.Sound != "normal" {
+		t.Errorf("доля 2 такта 2: %q, ожидалось normal", def.Sound)
+	}
+	if def := pat.Lookup(2, 3); def.Sound != "ghost" {
+		t.Errorf("доля 2 такта 3: %q, ожидалось ghost", def.Sound)
+	}
+
+	// Старая запись с долями 5-8 для второго такта
+	legacy := &Pattern{Beats: 4, Cycle: 2, Pattern: []BeatDefinition{{Beat: 1, Sound: "accent"}, {Beat: 5, Sound: "ride"}}}
+	if def := legacy.Lookup(1, 2); def.Sound != "ride" || def.Beat != 1 {
+		t.Errorf("старая запись: доля 1 такта 2 - %q (доля %d), ожидалось ride", def.Sound, def.Beat)
+	}
+}
+
+func TestPatternClone(t *testing.T) {
+	pat := PredefinedPatterns()["shuffle"]
+	pat.Fill = &Fill{Pattern: "rock-fill", Every: 4}
+	pat.Humanize = &Humanize{TimingMs: 5}
+
+	c := pat.Clone()
+	c.Pattern[0].Volume = 0.1
+	c.Bars[0].Pattern[0].Volume = 0.1
+	c.Fill.Every = 8
+	c.Humanize.TimingMs = 10
+
+	if pat.Pattern[0].Volume == 0.1 || pat.Bars[0].Pattern[0].Volume == 0.1 {
+		t.Errorf("доли копии общие с оригиналом")
+	}
+	if pat.Fill.Every != 4 || pat.Humanize.TimingMs != 5 {
+		t.Errorf("сбивка или humanize копии общие с оригиналом")
+	}
+}
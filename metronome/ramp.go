@@ -0,0 +1,83 @@
+package metronome
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RampCurve - форма кривой изменения темпа
+type RampCurve string
+
+const (
+	RampLinear      RampCurve = "linear"      // Равные приращения BPM
+	RampExponential RampCurve = "exponential" // Равные относительные приращения
+)
+
+// TempoRamp описывает плавное изменение темпа (accelerando/ritardando).
+// Длительность задается либо в тактах (Bars), либо во времени (Duration).
+type TempoRamp struct {
+	From     float64       // Начальный темп; 0 - текущий темп метронома
+	To       float64       // Целевой темп
+	Bars     int           // Длительность в тактах
+	Duration time.Duration // Длительность во времени (если Bars == 0)
+	Curve    RampCurve     // Форма кривой, по умолчанию линейная
+}
+
+// ParseRampCurve разбирает название кривой из командной строки
+func ParseRampCurve(name string) (RampCurve, error) {
+	switch name {
+	case "", "linear", "lin":
+		return RampLinear, nil
+	case "exponential", "exp":
+		return RampExponential, nil
+	default:
+		return "", fmt.Errorf("неизвестная кривая темпа '%s'", name)
+	}
+}
+
+// Validate проверяет параметры перехода
+func (r TempoRamp) Validate() error {
+	if r.To < 20 || r.To > 300 {
+		return fmt.Errorf("целевой темп должен быть от 20 до 300")
+	}
+	if r.From != 0 && (r.From < 20 || r.From > 300) {
+		return fmt.Errorf("начальный темп должен быть от 20 до 300")
+	}
+	if r.Bars < 0 || r.Duration < 0 {
+		return fmt.Errorf("длительность перехода не может быть отрицательной")
+	}
+	if r.Bars == 0 && r.Duration == 0 {
+		return fmt.Errorf("укажите длительность перехода в тактах или секундах")
+	}
+	if _, err := ParseRampCurve(string(r.Curve)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// tempoAt возвращает темп в точке перехода progress (0.0-1.0)
+func (r TempoRamp) tempoAt(progress float64) float64 {
+	progress = math.Max(0, math.Min(1, progress))
+
+	if r.Curve == RampExponential {
+		return r.From * math.Pow(r.To/r.From, progress)
+	}
+	return r.From + (r.To-r.From)*progress
+}
+
+// rampState - активный переход внутри секвенсора
+type rampState struct {
+	TempoRamp
+	startIndex int64   // Доля, с которой начался переход
+	startPos   float64 // Положение начала перехода в семплах
+}
+
+// progress возвращает долю пройденного перехода для доли index в позиции pos
+func (r *rampState) progress(index int64, pos float64, pulsesPerBar int) float64 {
+	if r.Bars > 0 {
+		return float64(index-r.startIndex) / float64(r.Bars*pulsesPerBar)
+	}
+	total := r.Duration.Seconds() * float64(sampleRate)
+	return (pos - r.startPos) / total
+}
@@ -0,0 +1,93 @@
+package metronome
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// playRamp играет n долей с переходом ramp, запущенным вместе с метрономом
+func playRamp(t *testing.T, bpm int, ramp TempoRamp, n int) (*Metronome, []TickEvent) {
+	t.Helper()
+
+	m, clock := newTestMetronome(t, bpm, 4, "basic")
+	if err := m.RampTo(ramp); err != nil {
+		t.Fatalf("RampTo: %v", err)
+	}
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	t.Cleanup(m.Stop)
+
+	return m, collect(t, clock, events, n)
+}
+
+// checkRampTempos сверяет темп каждой доли и промежутки между долями
+func checkRampTempos(t *testing.T, got []TickEvent, want []float64) {
+	t.Helper()
+
+	for i, e := range got {
+		if math.Abs(e.Tempo-want[i]) > 1e-9 {
+			t.Errorf("доля %d: темп %.3f, ожидалось %.3f", i+1, e.Tempo, want[i])
+		}
+		if i == 0 {
+			continue
+		}
+		// Доля длится столько, сколько задает темп ее начала
+		gap := e.Offset - got[i-1].Offset
+		if beat := time.Duration(float64(time.Minute) / want[i-1]); (gap - beat).Abs() > time.Millisecond {
+			t.Errorf("доля %d: промежуток %v, ожидалось %v", i+1, gap, beat)
+		}
+	}
+}
+
+func TestLinearRamp(t *testing.T) {
+	m, got := playRamp(t, 120, TempoRamp{To: 180, Bars: 2}, 12)
+
+	// Восемь долей перехода равными шагами, дальше - целевой темп
+	want := make([]float64, 12)
+	for i := range want {
+		want[i] = 120 + 60*math.Min(float64(i)/8, 1)
+	}
+	checkRampTempos(t, got, want)
+
+	if m.BPM != 180 {
+		t.Errorf("BPM после перехода %d, ожидалось 180", m.BPM)
+	}
+	if tempo := m.GetState().Tempo; tempo != 180 {
+		t.Errorf("текущий темп после перехода %v, ожидалось 180", tempo)
+	}
+}
+
+func TestExponentialRamp(t *testing.T) {
+	_, got := playRamp(t, 100, TempoRamp{To: 200, Bars: 1, Curve: RampExponential}, 8)
+
+	// Темп растет в одно и то же число раз с каждой долей
+	want := make([]float64, 8)
+	for i := range want {
+		want[i] = 100 * math.Pow(2, math.Min(float64(i)/4, 1))
+	}
+	checkRampTempos(t, got, want)
+}
+
+func TestRampByDuration(t *testing.T) {
+	_, got := playRamp(t, 60, TempoRamp{To: 120, Duration: 2 * time.Second}, 6)
+
+	// Темп считается по времени начала доли: 0s, 1s, 1.67s, затем цель
+	checkRampTempos(t, got, []float64{60, 90, 110, 120, 120, 120})
+}
+
+func TestRampValidate(t *testing.T) {
+	for _, bad := range []TempoRamp{
+		{To: 10, Bars: 4},
+		{From: 400, To: 120, Bars: 4},
+		{To: 120},
+		{To: 120, Bars: -1},
+		{To: 120, Bars: 4, Curve: "sine"},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) должен вернуть ошибку", bad)
+		}
+	}
+}
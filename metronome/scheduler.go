@@ -0,0 +1,158 @@
+package metronome
+
+import (
+	"sync"
+	"time"
+
+	"github.com/faiface/beep/speaker"
+)
+
+const (
+	// schedulerInterval - как часто планировщик просыпается, чтобы
+	// поставить в очередь новые удары
+	schedulerInterval = 25 * time.Millisecond
+	// scheduleAhead - насколько вперед планируются удары. Должно быть
+	// больше буфера динамика, иначе щелчок попадет в уже отданный блок.
+	scheduleAhead = 200 * time.Millisecond
+)
+
+// output принимает удары, запланированные на временной шкале метронома
+type output interface {
+	// Start начинает поток с позиции origin на шкале (0 - с начала)
+	Start(origin int64) error
+	// Schedule ставит удар в поток в позицию event.sample
+	Schedule(event TickEvent)
+	// Stop останавливает поток и отбрасывает запланированные удары
+	Stop()
+}
+
+// scheduledClick - отрендеренный щелчок с абсолютной позицией в потоке
+type scheduledClick struct {
+	start       int64
+	samples     []float64
+	left, right float64 // Усиление каналов по панораме
+}
+
+// panGains возвращает усиление левого и правого каналов для панорамы
+// pan (-1..1). В центре оба канала звучат в полную силу.
+func panGains(pan float64) (float64, float64) {
+	pan = max(-1, min(1, pan))
+	return min(1, 1-pan), min(1, 1+pan)
+}
+
+// clickStream - непрерывный аудиопоток, в который щелчки подмешиваются
+// с точностью до семпла. Поток никогда не заканчивается сам: между
+// щелчками он отдает тишину, пока его не закроют.
+type clickStream struct {
+	mu     sync.Mutex
+	pos    int64
+	clicks []scheduledClick
+	closed bool
+}
+
+func newClickStream(origin int64) *clickStream {
+	return &clickStream{pos: origin}
+}
+
+// add планирует щелчок в абсолютную позицию start с панорамой pan
+func (s *clickStream) add(start int64, samples []float64, pan float64) {
+	left, right := panGains(pan)
+	s.mu.Lock()
+	s.clicks = append(s.clicks, scheduledClick{start: start, samples: samples, left: left, right: right})
+	s.mu.Unlock()
+}
+
+func (s *clickStream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.clicks = nil
+	s.mu.Unlock()
+}
+
+// Stream реализует beep.Streamer
+func (s *clickStream) Stream(samples [][2]float64) (n int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, false
+	}
+
+	for i := range samples {
+		samples[i] = [2]float64{}
+	}
+
+	end := s.pos + int64(len(samples))
+	kept := s.clicks[:0]
+	for _, c := range s.clicks {
+		clickEnd := c.start + int64(len(c.samples))
+		if c.start < end {
+			// Опоздавший щелчок доигрываем с текущей позиции
+			from := max(c.start, s.pos)
+			to := min(clickEnd, end)
+			for t := from; t < to; t++ {
+				val := c.samples[t-c.start]
+				samples[t-s.pos][0] += val * c.left
+				samples[t-s.pos][1] += val * c.right
+			}
+		}
+		if clickEnd > end {
+			kept = append(kept, c)
+		}
+	}
+	s.clicks = kept
+	s.pos = end
+
+	return len(samples), true
+}
+
+// Err реализует beep.Streamer
+func (s *clickStream) Err() error {
+	return nil
+}
+
+// speakerOutput выводит удары через динамик одним непрерывным потоком
+type speakerOutput struct {
+	stream *clickStream
+}
+
+func (o *speakerOutput) Start(origin int64) error {
+	if err := initAudio(); err != nil {
+		return err
+	}
+	o.stream = newClickStream(origin)
+	speaker.Play(o.stream)
+	return nil
+}
+
+func (o *speakerOutput) Schedule(event TickEvent) {
+	if o.stream == nil {
+		return
+	}
+	if samples := renderEvent(event); len(samples) > 0 {
+		o.stream.add(event.sample, samples, event.Pan)
+	}
+}
+
+func (o *speakerOutput) Stop() {
+	if o.stream != nil {
+		o.stream.close()
+		o.stream = nil
+	}
+}
+
+// laneOutput - дорожка одного метронома в общем потоке ансамбля. Потоком
+// управляет ансамбль, поэтому Start и Stop дорожки ничего не делают.
+type laneOutput struct {
+	shared *speakerOutput
+}
+
+func (o *laneOutput) Start(origin int64) error {
+	return nil
+}
+
+func (o *laneOutput) Schedule(event TickEvent) {
+	o.shared.Schedule(event)
+}
+
+func (o *laneOutput) Stop() {}
@@ -0,0 +1,444 @@
+package metronome
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// sequencer вычисляет последовательность долей и их положение на общей
+// временной шкале в семплах. Положение каждой доли считается от абсолютного
+// начала воспроизведения, а не прибавлением интервала к предыдущей доле,
+// поэтому ошибка округления не накапливается даже за многочасовую сессию.
+//
+// Один и тот же sequencer используется живым воспроизведением и генерацией
+// WAV, так что оба пути дают одинаковую последовательность ударов.
+type sequencer struct {
+	tempo    float64       // Текущий темп в счетных долях (может быть дробным)
+	meter    TimeSignature // Размер: сколько пульсаций в такте и какой длины
+	beatUnit NoteValue     // Счетная доля, к которой относится темп
+	pattern  *Pattern
+	ramp     *rampState     // Активный переход темпа
+	trainer  *trainerState  // Тренажер скорости
+	mute     *muteState     // Правила приглушения долей
+	song     *songState     // Структура песни
+	countIn  *countInState  // Отсчет перед первым тактом
+	humanize *humanizeState // Отклонения ударов от сетки
+	trig     *trigState     // Условия срабатывания долей
+
+	modulation *MetricModulation // Модуляция, ждущая тактовой черты
+	limit      *limitState       // Предел сессии
+	grouping   *Grouping         // Группировка поверх паттерна
+	fill       *Fill             // Сбивка метронома; nil - из раздела или паттерна
+	fills      fillState         // Сбивка текущего такта
+
+	subdivision int         // Деление для долей без собственного Subdiv
+	queue       []TickEvent // Подразделения текущей доли, еще не выданные
+
+	tempoChanged bool // Темп сменился скачком, сообщим со следующей долей
+
+	beat int // Последняя выданная доля в такте (1-based, 0 - еще не начали)
+	bar  int // Текущий такт
+
+	index       int64   // Порядковый номер следующей доли от начала
+	anchorIndex int64   // Доля, от которой отсчитывается текущий темп
+	anchorPos   float64 // Точное (дробное) положение доли anchorIndex в семплах
+}
+
+func newSequencer(bpm int, meter TimeSignature, beatUnit NoteValue, pattern *Pattern) *sequencer {
+	return &sequencer{
+		tempo:    float64(bpm),
+		meter:    meter,
+		beatUnit: beatUnit,
+		pattern:  pattern,
+		beat:     0,
+		bar:      1,
+	}
+}
+
+// samplesPerPulse возвращает длину пульсации такта в семплах (дробную).
+// Темп задан в счетных долях, поэтому, например, в 6/8 с темпом по
+// четвертям с точкой одна восьмая занимает треть счетной доли.
+func (s *sequencer) samplesPerPulse() float64 {
+	ratio := float64(s.meter.Pulse()) / float64(s.beatUnit)
+	return float64(sampleRate) * 60.0 / s.tempo * ratio
+}
+
+// exactPosition возвращает точное положение следующей основной доли в семплах
+func (s *sequencer) exactPosition() float64 {
+	return s.anchorPos + float64(s.index-s.anchorIndex)*s.samplesPerPulse()
+}
+
+// position возвращает положение следующего удара (доли или подразделения)
+// в семплах
+func (s *sequencer) position() int64 {
+	if len(s.queue) > 0 {
+		return s.queue[0].sample
+	}
+	return int64(math.Round(s.exactPosition()))
+}
+
+// offset возвращает положение следующей доли от начала воспроизведения
+func (s *sequencer) offset() time.Duration {
+	return samplesToDuration(s.position())
+}
+
+// next выдает следующий удар и продвигает позицию. Отклонения humanize
+// применяются к готовому удару и не влияют на сетку следующих долей.
+func (s *sequencer) next() TickEvent {
+	event := s.nextOnGrid()
+	if s.humanize != nil && !event.CountIn {
+		s.humanize.apply(&event, s.pattern.Humanize)
+	}
+	return event
+}
+
+// nextOnGrid выдает следующий удар точно по сетке
+func (s *sequencer) nextOnGrid() TickEvent {
+	if len(s.queue) > 0 {
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+		return event
+	}
+	if s.countIn != nil {
+		return s.nextCountIn()
+	}
+
+	s.applyRamp()
+	exact := s.exactPosition()
+	pos := int64(math.Round(exact))
+
+	s.beat++
+	if s.beat > s.meter.Numerator {
+		s.beat = 1
+		s.bar++
+	}
+
+	// Номер такта для паттерна: в песне паттерн отсчитывается от начала раздела
+	patternBar := s.bar
+	var section string
+	sectionChanged := false
+	if s.song != nil {
+		if s.beat == 1 && s.song.nextBar() {
+			s.enterSection(s.song.part())
+			sectionChanged = true
+		}
+		patternBar = s.song.bar
+		section = s.song.part().section.Name
+	}
+
+	// Модуляция срабатывает на тактовой черте; в песне раздел может
+	// начинаться с собственной модуляции
+	var modulation *MetricModulation
+	if sectionChanged {
+		modulation = s.song.part().section.modulation
+	}
+	if s.beat == 1 && s.modulation != nil {
+		modulation = s.modulation
+		s.modulation = nil
+		s.ramp = nil
+		s.changeTempo(min(max(modulation.NextTempo(s.tempo, s.beatUnit, s.beatUnit), 20), 300))
+	}
+
+	var trainer *TrainerStatus
+	if s.trainer != nil {
+		if s.beat == 1 {
+			if tempo, changed := s.trainer.onBar(); changed {
+				s.changeTempo(float64(tempo))
+			}
+		}
+		trainer = s.trainer.status()
+	}
+
+	lastBar := false
+	if s.limit != nil {
+		if s.beat == 1 {
+			length := float64(s.meter.Numerator) * s.samplesPerPulse()
+			s.limit.onBar(s.bar, exact, length)
+		}
+		lastBar = s.limit.last
+	}
+
+	if s.beat == 1 {
+		s.fills.onBar(s.activeFill(), s.pattern, patternBar)
+	}
+
+	def, grouping := s.lookup(s.beat, patternBar)
+	trigPattern, trigBar := s.pattern, patternBar
+	fill := s.fills.fill != nil
+	if fill {
+		trigPattern, trigBar = s.fills.fill.pattern, s.fills.count
+		def = trigPattern.Lookup(s.beat, trigBar)
+	}
+	// Доля с невыполненным условием молчит, но счет продолжается
+	if s.trig != nil && !s.trig.plays(def, trigBar, trigPattern) {
+		def = BeatDefinition{Beat: s.beat, Sound: "silent", Volume: 0}
+	}
+	if s.fills.crash && s.beat == 1 {
+		def.Sound = "crash"
+		def.Volume = 1.0
+	}
+	// Сильная доля последнего такта предупреждает о конце сессии
+	if lastBar && s.beat == 1 {
+		def.Sound = "warning"
+		def.Volume = 1.0
+	}
+	muted := s.mute != nil && s.mute.muted(s.bar)
+	s.index++
+
+	subdiv := def.Subdiv
+	if subdiv <= 1 {
+		subdiv = s.subdivision
+	}
+	subdiv = max(subdiv, 1)
+
+	event := TickEvent{
+		Beat:           s.beat,
+		Bar:            s.bar,
+		BeatsPerBar:    s.meter.Numerator,
+		TimeSignature:  s.meter,
+		Subdivision:    subdiv,
+		Volume:         def.Volume,
+		Sound:          def.Sound,
+		Muted:          muted,
+		Tempo:          s.tempo,
+		TempoChanged:   s.tempoChanged,
+		Trainer:        trainer,
+		Section:        section,
+		SectionChanged: sectionChanged,
+		Modulation:     modulation,
+		LastBar:        lastBar,
+		Fill:           fill,
+		Grouping:       grouping,
+		Offset:         samplesToDuration(pos),
+		sample:         pos,
+		length:         int(s.samplesPerPulse()),
+		pattern:        s.pattern,
+	}
+	s.tempoChanged = false
+
+	return s.expandPulse(event, exact)
+}
+
+// activeFill возвращает сбивку: метронома, затем раздела песни, затем
+// паттерна
+func (s *sequencer) activeFill() *Fill {
+	if s.fill != nil {
+		return s.fill
+	}
+	if s.song != nil {
+		if f := s.song.part().section.Fill; f != nil {
+			return f
+		}
+	}
+	return s.pattern.Fill
+}
+
+// lookup возвращает определение доли и группировку такта. Группировка
+// метронома важнее паттерна, но только если подходит к текущему размеру.
+func (s *sequencer) lookup(beat, bar int) (BeatDefinition, *Grouping) {
+	if g := s.grouping; g != nil && g.Meter().Numerator == s.meter.Numerator {
+		return g.Definition(beat), g
+	}
+
+	g := s.pattern.BeatGrouping()
+	if g != nil && g.Meter().Numerator != s.meter.Numerator {
+		g = nil
+	}
+	return s.pattern.Lookup(beat, bar), g
+}
+
+// nextCountIn выдает долю отсчета. Отсчет не двигает счет долей и тактов
+// и не подразделяется; переход темпа начинается только после него.
+func (s *sequencer) nextCountIn() TickEvent {
+	pos := int64(math.Round(s.exactPosition()))
+	bar, count, last := s.countIn.next(s.meter.Numerator)
+
+	sound, volume := "count", 0.7
+	switch count {
+	case 0:
+		sound, volume = "silent", 0
+	case 1:
+		sound, volume = "count-accent", 1.0
+	}
+
+	event := TickEvent{
+		Beat:          s.countIn.beat,
+		Bar:           bar,
+		BeatsPerBar:   s.meter.Numerator,
+		TimeSignature: s.meter,
+		Subdivision:   1,
+		Volume:        volume,
+		Sound:         sound,
+		Tempo:         s.tempo,
+		CountIn:       true,
+		Count:         count,
+		Offset:        samplesToDuration(pos),
+		sample:        pos,
+		length:        int(s.samplesPerPulse()),
+		pattern:       s.pattern,
+	}
+	s.index++
+
+	if last {
+		if s.countIn.ramp != nil {
+			s.startRamp(*s.countIn.ramp)
+		}
+		s.countIn = nil
+	}
+
+	return event
+}
+
+// expandPulse раскладывает долю, начинающуюся в точной позиции start.
+// Удары слоев, совпавшие с самой долей, добавляются к ней, а подразделения
+// и остальные удары слоев ставятся в очередь в порядке времени. Подразделения
+// делят долю поровну при текущем темпе.
+func (s *sequencer) expandPulse(main TickEvent, start float64) TickEvent {
+	pulse := s.samplesPerPulse()
+	n := max(main.Subdivision, 1)
+
+	// Положение внутри доли храним дробью num/den
+	type slot struct {
+		num, den int
+		event    TickEvent
+	}
+	var slots []slot
+
+	for sub := 1; sub < n; sub++ {
+		voice := s.pattern.subdivisionVoice(subdivisionLevel(sub, n))
+
+		event := s.followUp(main)
+		event.SubBeat = sub
+		event.Sound = voice.Sound
+		event.Volume = voice.Volume
+		event.length = int(pulse / float64(n))
+		slots = append(slots, slot{num: sub, den: n, event: event})
+	}
+
+	for _, lh := range layerHitsInPulse(s.pattern.Layers, s.meter.Numerator, main.Beat-1, pulse) {
+		if lh.num == 0 {
+			main.Hits = append(main.Hits, lh.hit)
+			continue
+		}
+
+		found := false
+		for i := range slots {
+			if slots[i].num*lh.den == lh.num*slots[i].den {
+				slots[i].event.Hits = append(slots[i].event.Hits, lh.hit)
+				found = true
+				break
+			}
+		}
+		if !found {
+			event := s.followUp(main)
+			event.LayerOnly = true
+			event.Sound = ""
+			event.Volume = 0
+			event.Hits = []LayerHit{lh.hit}
+			event.length = lh.hit.length
+			slots = append(slots, slot{num: lh.num, den: lh.den, event: event})
+		}
+	}
+
+	sort.SliceStable(slots, func(i, j int) bool {
+		return slots[i].num*slots[j].den < slots[j].num*slots[i].den
+	})
+	for _, sl := range slots {
+		pos := int64(math.Round(start + pulse*float64(sl.num)/float64(sl.den)))
+		sl.event.Offset = samplesToDuration(pos)
+		sl.event.sample = pos
+		s.queue = append(s.queue, sl.event)
+	}
+
+	return main
+}
+
+// followUp возвращает заготовку события внутри доли main: тот же такт
+// и доля, но без разовых отметок о смене темпа и раздела
+func (s *sequencer) followUp(main TickEvent) TickEvent {
+	event := main
+	event.TempoChanged = false
+	event.SectionChanged = false
+	event.Modulation = nil
+	event.Hits = nil
+	return event
+}
+
+// enterSection переключает размер, паттерн и темп на раздел песни
+func (s *sequencer) enterSection(part *songPart) {
+	s.setMeter(part.section.meter, part.section.beatUnit)
+	s.pattern = part.section.pattern
+	if tempo := part.section.tempo; tempo != s.tempo {
+		s.changeTempo(tempo)
+	}
+}
+
+// finished сообщает, что песня или сессия доиграна и долей больше не будет
+func (s *sequencer) finished() bool {
+	if s.beat < s.meter.Numerator || len(s.queue) > 0 {
+		return false
+	}
+	return (s.song != nil && s.song.lastBar()) || (s.limit != nil && s.limit.last)
+}
+
+// setTempo меняет темп начиная со следующей доли. Уже пройденная часть
+// шкалы фиксируется в якоре, поэтому смена темпа не сдвигает прошлые доли.
+func (s *sequencer) setTempo(bpm float64) {
+	s.anchorPos = s.exactPosition()
+	s.anchorIndex = s.index
+	s.tempo = bpm
+}
+
+// setMeter меняет размер и счетную долю начиная со следующей доли
+func (s *sequencer) setMeter(meter TimeSignature, beatUnit NoteValue) {
+	s.anchorPos = s.exactPosition()
+	s.anchorIndex = s.index
+	s.meter = meter
+	s.beatUnit = beatUnit
+}
+
+// changeTempo меняет темп скачком и отмечает смену для подписчиков
+func (s *sequencer) changeTempo(bpm float64) {
+	s.setTempo(bpm)
+	s.tempoChanged = true
+}
+
+// startRamp запускает переход темпа со следующей доли
+func (s *sequencer) startRamp(ramp TempoRamp) {
+	if ramp.From == 0 {
+		ramp.From = s.tempo
+	}
+	if ramp.Curve == "" {
+		ramp.Curve = RampLinear
+	}
+	s.ramp = &rampState{
+		TempoRamp:  ramp,
+		startIndex: s.index,
+		startPos:   s.exactPosition(),
+	}
+}
+
+// applyRamp выставляет темп для следующей доли по активному переходу
+func (s *sequencer) applyRamp() {
+	if s.ramp == nil {
+		return
+	}
+
+	progress := s.ramp.progress(s.index, s.exactPosition(), s.meter.Numerator)
+	s.setTempo(s.ramp.tempoAt(progress))
+	if progress >= 1 {
+		s.ramp = nil
+	}
+}
+
+// resetCount начинает счет долей и тактов заново, не сдвигая временную шкалу
+func (s *sequencer) resetCount() {
+	s.beat = 0
+	s.bar = 1
+}
+
+// samplesToDuration переводит позицию в семплах во время
+func samplesToDuration(samples int64) time.Duration {
+	return time.Duration(float64(samples) * float64(time.Second) / float64(sampleRate))
+}
@@ -0,0 +1,150 @@
+package metronome
+
+import (
+	"fmt"
+	"time"
+)
+
+// SessionLimit - предел занятия по времени или числу тактов. Сессия всегда
+// заканчивается на тактовой черте: предел по времени доигрывает такт, в
+// котором время вышло. На сильной доле последнего такта звучит
+// предупреждающий щелчок. Отсчет в предел не входит.
+type SessionLimit struct {
+	Duration time.Duration // Сколько играть; 0 - без предела по времени
+	Bars     int           // Сколько тактов играть; 0 - без предела
+}
+
+// Validate проверяет предел сессии
+func (l SessionLimit) Validate() error {
+	if l.Duration < 0 || l.Bars < 0 {
+		return fmt.Errorf("предел сессии не может быть отрицательным")
+	}
+	if l.Duration > 0 && l.Duration < time.Second {
+		return fmt.Errorf("сессия должна длиться хотя бы секунду")
+	}
+	return nil
+}
+
+// limitState отслеживает предел сессии внутри секвенсора
+type limitState struct {
+	SessionLimit
+	origin  float64 // Положение первой доли первого такта в семплах
+	started bool
+	last    bool // Идет последний такт
+}
+
+// onBar вызывается на сильной доле такта bar, начинающегося в start и
+// длящегося length семплов. Возвращает true, если такт последний.
+func (l *limitState) onBar(bar int, start, length float64) bool {
+	if !l.started {
+		l.started = true
+		l.origin = start
+	}
+
+	if l.Bars > 0 && bar >= l.Bars {
+		l.last = true
+	}
+	// Полсемпла допуска на округление
+	end := l.origin + l.Duration.Seconds()*float64(sampleRate)
+	if l.Duration > 0 && start+length >= end-0.5 {
+		l.last = true
+	}
+	return l.last
+}
+
+// SetSessionLimit задает предел занятия. Доиграв его, метроном
+// останавливается сам, как в конце песни.
+func (m *Metronome) SetSessionLimit(limit SessionLimit) error {
+	if err := limit.Validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.limit = &limit
+	if m.seq != nil {
+		m.seq.limit = &limitState{SessionLimit: limit}
+	}
+
+	return nil
+}
+
+// SessionSummary - итоги занятия с последнего запуска
+type SessionSummary struct {
+	Bars     int      `json:"bars"`    // Сыграно тактов (без отсчета)
+	Beats    int      `json:"beats"`   // Сыграно долей
+	Seconds  float64  `json:"seconds"` // Время игры без пауз и отсчета
+	TempoMin float64  `json:"tempo_min"`
+	TempoMax float64  `json:"tempo_max"`
+	Pattern  string   `json:"pattern"`            // Паттерн последней доли
+	Patterns []string `json:"patterns,omitempty"` // Все сыгранные паттерны по порядку
+	Finished bool     `json:"finished"`           // Доиграно до конца песни или предела сессии
+}
+
+// Played возвращает время игры
+func (s SessionSummary) Played() time.Duration {
+	return time.Duration(s.Seconds * float64(time.Second))
+}
+
+// sessionStats накапливает итоги занятия. Обновляется под m.mu.
+type sessionStats struct {
+	summary SessionSummary
+	origin  time.Duration // Положение первой доли после отсчета
+	started bool
+	played  time.Duration // Итоговое время после остановки
+}
+
+// count учитывает наступившую долю
+func (s *sessionStats) count(event TickEvent) {
+	if event.CountIn || event.SubBeat > 0 || event.LayerOnly {
+		return
+	}
+	if !s.started {
+		s.started = true
+		s.origin = event.Offset - event.Shift
+		s.summary.TempoMin = event.Tempo
+		s.summary.TempoMax = event.Tempo
+	}
+
+	sum := &s.summary
+	sum.Beats++
+	sum.Bars = max(sum.Bars, event.Bar)
+	sum.TempoMin = min(sum.TempoMin, event.Tempo)
+	sum.TempoMax = max(sum.TempoMax, event.Tempo)
+	if event.pattern != nil {
+		sum.Pattern = event.pattern.Name
+		if n := len(sum.Patterns); n == 0 || sum.Patterns[n-1] != sum.Pattern {
+			sum.Patterns = append(sum.Patterns, sum.Pattern)
+		}
+	}
+}
+
+// Summary возвращает итоги занятия с последнего запуска. После остановки
+// итоги сохраняются до следующего Play.
+func (m *Metronome) Summary() SessionSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	if stats == nil {
+		return SessionSummary{}
+	}
+
+	var timeline time.Duration
+	switch m.state {
+	case TransportPlaying:
+		timeline = m.clock.Now().Sub(m.startTime)
+	case TransportPaused:
+		timeline = m.pausedAt
+	default:
+		timeline = stats.played
+	}
+
+	summary := stats.summary
+	summary.Patterns = append([]string(nil), stats.summary.Patterns...)
+	if stats.started {
+		summary.Seconds = max(timeline-stats.origin, 0).Round(time.Millisecond).Seconds()
+	}
+	return summary
+}
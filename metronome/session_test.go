@@ -0,0 +1,132 @@
+package metronome
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// playUntilStopped двигает часы, пока метроном не остановится сам,
+// и возвращает все доли
+func playUntilStopped(t *testing.T, m *Metronome, clock *FakeClock) []TickEvent {
+	t.Helper()
+
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	done := m.Done()
+
+	// После остановки таймер больше не взводится, поэтому ждем либо
+	// окончания прохода планировщика, либо остановки
+	idle := func() bool {
+		armed := make(chan struct{})
+		go func() {
+			clock.BlockUntil(1)
+			close(armed)
+		}()
+		select {
+		case <-armed:
+			return false
+		case <-done:
+			return true
+		}
+	}
+
+	var got []TickEvent
+	for {
+		stopped := idle()
+		for drained := false; !drained; {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					// Канал закрыт при остановке
+					events = nil
+					continue
+				}
+				got = append(got, event)
+			default:
+				drained = true
+			}
+		}
+		if stopped {
+			return got
+		}
+		if clock.Now().Sub(testStart) > time.Minute {
+			t.Fatal("метроном не остановился")
+		}
+		clock.Advance(testStep)
+	}
+}
+
+func TestSessionLimitBars(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetSessionLimit(SessionLimit{Bars: 2}); err != nil {
+		t.Fatalf("SetSessionLimit: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub := m.SubscribeEvents(ctx, OnlyKinds(KindStopped))
+
+	got := playUntilStopped(t, m, clock)
+	if len(got) != 8 {
+		t.Fatalf("сыграно %d долей, ожидалось 8", len(got))
+	}
+	for _, e := range got {
+		if e.LastBar != (e.Bar == 2) {
+			t.Errorf("такт %d доля %d: LastBar = %v", e.Bar, e.Beat, e.LastBar)
+		}
+	}
+	if got[4].Sound != "warning" || got[5].Sound == "warning" {
+		t.Errorf("предупреждение должно звучать только на сильной доле последнего такта: %q, %q", got[4].Sound, got[5].Sound)
+	}
+	if stopped := (<-sub.Events()).(Stopped); !stopped.Finished {
+		t.Error("Stopped должен быть с Finished")
+	}
+
+	summary := m.Summary()
+	if summary.Bars != 2 || summary.Beats != 8 || !summary.Finished {
+		t.Errorf("итоги %+v", summary)
+	}
+	if summary.Played() != 4*time.Second {
+		t.Errorf("время игры %v, ожидалось 4s (последняя доля дозвучала)", summary.Played())
+	}
+	if summary.TempoMin != 120 || summary.TempoMax != 120 || summary.Pattern != "basic" {
+		t.Errorf("итоги %+v", summary)
+	}
+}
+
+func TestSessionLimitDurationEndsOnBarLine(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	// 5 секунд кончаются в третьем такте - он доигрывается
+	if err := m.SetSessionLimit(SessionLimit{Duration: 5 * time.Second}); err != nil {
+		t.Fatalf("SetSessionLimit: %v", err)
+	}
+	if err := m.SetCountIn(CountIn{Bars: 1}); err != nil {
+		t.Fatalf("SetCountIn: %v", err)
+	}
+
+	got := playUntilStopped(t, m, clock)
+	last := got[len(got)-1]
+	if last.Bar != 3 || last.Beat != 4 {
+		t.Errorf("последняя доля: такт %d доля %d, ожидалось 3/4", last.Bar, last.Beat)
+	}
+	// Отсчет в итоги не входит
+	if summary := m.Summary(); summary.Bars != 3 || summary.Played() != 6*time.Second {
+		t.Errorf("итоги %+v", summary)
+	}
+}
+
+func TestSummaryWhileStoppedByUser(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	collect(t, clock, events, 3)
+	m.Stop()
+
+	if summary := m.Summary(); summary.Beats != 3 || summary.Finished {
+		t.Errorf("итоги %+v", summary)
+	}
+}
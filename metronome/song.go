@@ -0,0 +1,206 @@
+package metronome
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Song описывает структуру песни: последовательность разделов со своим
+// темпом, размером и паттерном
+type Song struct {
+	Name     string    `json:"name"`
+	BPM      int       `json:"bpm"`    // Темп по умолчанию для разделов
+	Repeat   int       `json:"repeat"` // Сколько раз сыграть песню целиком
+	Sections []Section `json:"sections"`
+}
+
+// Section - раздел песни (вступление, куплет, припев...)
+type Section struct {
+	Name     string `json:"name"`
+	Bars     int    `json:"bars"`      // Длина раздела в тактах
+	Time     string `json:"time"`      // Размер, например "6/8"
+	BeatUnit string `json:"beat_unit"` // Счетная доля темпа, например "4."
+	BPM      int    `json:"bpm"`       // Темп; 0 - темп предыдущего раздела
+	Pattern  string `json:"pattern"`   // Название паттерна
+	Repeat   int    `json:"repeat"`    // Сколько раз повторить раздел подряд
+
+	// Метрическая модуляция от предыдущего раздела, например "4=4."
+	// (новая четверть = старая четверть с точкой); вместо BPM
+	Modulation string `json:"modulation,omitempty"`
+	// Сбивка раздела; важнее сбивки его паттерна
+	Fill *Fill `json:"fill,omitempty"`
+
+	meter      TimeSignature
+	beatUnit   NoteValue
+	tempo      float64
+	pattern    *Pattern
+	modulation *MetricModulation
+}
+
+// LoadSongFromFile загружает песню из JSON файла
+func LoadSongFromFile(filename string) (*Song, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	var song Song
+	if err := json.Unmarshal(data, &song); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+
+	return &song, nil
+}
+
+// Resolve проверяет разделы и находит их паттерны через lookup.
+// Песню нужно разрешить перед воспроизведением.
+func (s *Song) Resolve(lookup func(name string) (*Pattern, error)) error {
+	if len(s.Sections) == 0 {
+		return fmt.Errorf("в песне нет ни одного раздела")
+	}
+	if s.Repeat < 0 {
+		return fmt.Errorf("количество повторов песни не может быть отрицательным")
+	}
+
+	tempo := float64(s.BPM)
+	if tempo == 0 {
+		tempo = 120
+	}
+	var prevUnit NoteValue
+
+	for i := range s.Sections {
+		sec := &s.Sections[i]
+		name := sec.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if sec.Bars < 1 {
+			return fmt.Errorf("раздел %s: длина должна быть не меньше одного такта", name)
+		}
+		if sec.Repeat < 0 {
+			return fmt.Errorf("раздел %s: количество повторов не может быть отрицательным", name)
+		}
+
+		patternName := sec.Pattern
+		if patternName == "" {
+			patternName = "basic"
+		}
+		pattern, err := lookup(patternName)
+		if err != nil {
+			return fmt.Errorf("раздел %s: %w", name, err)
+		}
+		sec.pattern = pattern
+		if sec.Fill != nil {
+			if sec.Fill.Every == 0 && pattern.CycleLength() < 2 {
+				return fmt.Errorf("раздел %s: у сбивки не задан период, а цикла у паттерна нет", name)
+			}
+			if err := sec.Fill.Resolve(lookup); err != nil {
+				return fmt.Errorf("раздел %s: %w", name, err)
+			}
+		}
+
+		// Размер и счетная доля по умолчанию берутся из паттерна
+		sec.meter = pattern.TimeSignature()
+		sec.beatUnit = pattern.DefaultBeatUnit()
+		if sec.Time != "" {
+			if sec.meter, err = ParseTimeSignature(sec.Time); err != nil {
+				return fmt.Errorf("раздел %s: %w", name, err)
+			}
+			sec.beatUnit = sec.meter.DefaultBeatUnit()
+		}
+		if sec.BeatUnit != "" {
+			if sec.beatUnit, err = ParseNoteValue(sec.BeatUnit); err != nil {
+				return fmt.Errorf("раздел %s: %w", name, err)
+			}
+		}
+
+		// Темп нужен после счетной доли: модуляция пересчитывает его
+		// из счетной доли предыдущего раздела в счетную долю этого
+		sec.modulation = nil
+		switch {
+		case sec.Modulation != "" && sec.BPM != 0:
+			return fmt.Errorf("раздел %s: укажите либо bpm, либо modulation", name)
+		case sec.Modulation != "" && i == 0:
+			return fmt.Errorf("раздел %s: модуляции не от чего отсчитываться в первом разделе", name)
+		case sec.Modulation != "":
+			mm, err := ParseMetricModulation(sec.Modulation)
+			if err != nil {
+				return fmt.Errorf("раздел %s: %w", name, err)
+			}
+			tempo = mm.NextTempo(tempo, prevUnit, sec.beatUnit)
+			if err := validModulatedTempo(mm, tempo); err != nil {
+				return fmt.Errorf("раздел %s: %w", name, err)
+			}
+			sec.modulation = &mm
+		case sec.BPM != 0:
+			tempo = float64(sec.BPM)
+		}
+		if tempo < 20 || tempo > 300 {
+			return fmt.Errorf("раздел %s: BPM должен быть от 20 до 300", name)
+		}
+		sec.tempo = tempo
+		prevUnit = sec.beatUnit
+	}
+
+	return nil
+}
+
+// songPart - раздел в развернутой последовательности воспроизведения
+type songPart struct {
+	section *Section
+	pass    int // Номер повтора раздела (1-based)
+}
+
+// songState ведет воспроизведение песни внутри секвенсора
+type songState struct {
+	parts   []songPart
+	current int
+	bar     int // Такт внутри текущего раздела (1-based)
+	started bool
+}
+
+func newSongState(song *Song) *songState {
+	repeat := max(song.Repeat, 1)
+
+	var parts []songPart
+	for r := 0; r < repeat; r++ {
+		for i := range song.Sections {
+			sec := &song.Sections[i]
+			for pass := 1; pass <= max(sec.Repeat, 1); pass++ {
+				parts = append(parts, songPart{section: sec, pass: pass})
+			}
+		}
+	}
+
+	return &songState{parts: parts}
+}
+
+// part возвращает текущий раздел
+func (s *songState) part() *songPart {
+	return &s.parts[s.current]
+}
+
+// nextBar переходит к следующему такту. Возвращает true, если начался
+// новый раздел.
+func (s *songState) nextBar() bool {
+	if !s.started {
+		s.started = true
+		s.bar = 1
+		return true
+	}
+
+	s.bar++
+	if s.bar > s.part().section.Bars {
+		s.current++
+		s.bar = 1
+		return true
+	}
+	return false
+}
+
+// lastBar сообщает, что идет последний такт последнего раздела
+func (s *songState) lastBar() bool {
+	return s.started && s.current == len(s.parts)-1 && s.bar == s.part().section.Bars
+}
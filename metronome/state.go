@@ -0,0 +1,148 @@
+package metronome
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State - снимок состояния метронома: позиция, темп, размер, паттерн
+// и тренажер. Снимок сериализуется в JSON и восстанавливается через
+// Restore.
+type State struct {
+	Transport     TransportState `json:"transport"`
+	Bar           int            `json:"bar"`   // Последний прозвучавший такт
+	Beat          int            `json:"beat"`  // Последняя прозвучавшая доля (0 - еще не играл)
+	BPM           int            `json:"bpm"`   // Заданный темп
+	Tempo         float64        `json:"tempo"` // Темп последней доли (дробный во время перехода)
+	TimeSignature TimeSignature  `json:"time_signature"`
+	BeatUnit      NoteValue      `json:"beat_unit"`
+	Subdivision   int            `json:"subdivision,omitempty"`
+	Pattern       string         `json:"pattern"`
+	Section       string         `json:"section,omitempty"` // Раздел песни
+	Trainer       *TrainerConfig `json:"trainer,omitempty"`
+	TrainerStatus *TrainerStatus `json:"trainer_status,omitempty"`
+	SavedAt       time.Time      `json:"saved_at"`
+}
+
+// GetState возвращает снимок текущего состояния
+func (m *Metronome) GetState() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := State{
+		Transport:     m.state,
+		Bar:           m.barCount,
+		Beat:          m.beatCount,
+		BPM:           m.BPM,
+		Tempo:         m.tempo,
+		TimeSignature: m.TimeSignature,
+		BeatUnit:      m.BeatUnit,
+		Subdivision:   m.subdivision,
+		Section:       m.section,
+		TrainerStatus: m.trainerStatus,
+		SavedAt:       m.clock.Now(),
+	}
+	if st.Tempo == 0 {
+		st.Tempo = float64(m.BPM)
+	}
+	if m.Pattern != nil {
+		st.Pattern = m.Pattern.Name
+	}
+	if m.trainer != nil {
+		trainer := *m.trainer
+		st.Trainer = &trainer
+	}
+
+	return st
+}
+
+// Restore применяет снимок к остановленному метроному: темп, размер,
+// паттерн (его находит lookup) и тренажер. Позиция ставится на начало
+// сохраненного такта, и следующий Play продолжит игру с него.
+func (m *Metronome) Restore(st State, lookup func(name string) (*Pattern, error)) error {
+	if st.BPM < 20 || st.BPM > 300 {
+		return fmt.Errorf("BPM должен быть от 20 до 300")
+	}
+	if err := st.TimeSignature.Validate(); err != nil {
+		return err
+	}
+	if st.BeatUnit <= 0 {
+		st.BeatUnit = st.TimeSignature.DefaultBeatUnit()
+	}
+	if err := ValidateSubdivision(st.Subdivision); err != nil {
+		return err
+	}
+	if st.Trainer != nil {
+		if err := st.Trainer.Validate(); err != nil {
+			return err
+		}
+	}
+
+	pattern, err := lookup(st.Pattern)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Состояние проверяется под той же блокировкой, что и применяется:
+	// иначе Play между проверкой и применением подменит настройки на ходу
+	if m.state != TransportStopped {
+		return fmt.Errorf("восстановить состояние можно только у остановленного метронома")
+	}
+	m.BPM = st.BPM
+	m.Pattern = pattern
+	m.TimeSignature = st.TimeSignature
+	m.BeatsPerBar = st.TimeSignature.Numerator
+	m.BeatUnit = st.BeatUnit
+	m.subdivision = st.Subdivision
+	m.ramp = nil
+	m.trainer = nil
+	if st.Trainer != nil {
+		trainer := *st.Trainer
+		m.trainer = &trainer
+		m.BPM = trainer.Start
+	}
+
+	if st.Bar > 1 {
+		return m.seek(st.Bar, 1)
+	}
+	return nil
+}
+
+// SaveToFile сохраняет снимок в JSON файл
+func (s State) SaveToFile(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("ошибка создания директории: %w", err)
+	}
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("ошибка записи файла: %w", err)
+	}
+
+	return nil
+}
+
+// LoadStateFromFile загружает снимок из JSON файла
+func LoadStateFromFile(filename string) (*State, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+
+	return &st, nil
+}
@@ -0,0 +1,117 @@
+package metronome
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testLookup(name string) (*Pattern, error) {
+	if p, ok := PredefinedPatterns()[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("паттерн %q не найден", name)
+}
+
+func TestStateJSONRoundTrip(t *testing.T) {
+	st := State{
+		Transport:     TransportPaused,
+		Bar:           7,
+		Beat:          2,
+		BPM:           90,
+		Tempo:         90,
+		TimeSignature: TimeSignature{Numerator: 6, Denominator: 8},
+		BeatUnit:      Quarter * 1.5,
+		Subdivision:   3,
+		Pattern:       "6-8",
+		Trainer:       &TrainerConfig{Start: 90, Step: 5, Interval: 4, Target: 120, Repeat: 1},
+		SavedAt:       testStart,
+	}
+
+	filename := filepath.Join(t.TempDir(), "session.json")
+	if err := st.SaveToFile(filename); err != nil {
+		t.Fatalf("SaveToFile: %v", err)
+	}
+	loaded, err := LoadStateFromFile(filename)
+	if err != nil {
+		t.Fatalf("LoadStateFromFile: %v", err)
+	}
+
+	want, _ := json.Marshal(st)
+	got, _ := json.Marshal(loaded)
+	if string(got) != string(want) {
+		t.Errorf("после загрузки:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestRestoreContinuesFromSavedBar(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	st := State{
+		Bar:           3,
+		Beat:          4,
+		BPM:           60,
+		TimeSignature: CommonTime(3),
+		BeatUnit:      Quarter,
+		Pattern:       "waltz",
+	}
+	if err := m.Restore(st, testLookup); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+
+	got := collect(t, clock, events, 4)
+	want := []tick{
+		{3, 1, "accent", 6 * time.Second},
+		{3, 2, "normal", 7 * time.Second},
+		{3, 3, "normal", 8 * time.Second},
+		{4, 1, "accent", 9 * time.Second},
+	}
+	if !slices.Equal(ticks(got), want) {
+		t.Errorf("после восстановления:\n got %v\nwant %v", ticks(got), want)
+	}
+
+	snapshot := m.GetState()
+	if snapshot.Pattern != "waltz" || snapshot.BPM != 60 || snapshot.Bar != 4 || snapshot.Transport != TransportPlaying {
+		t.Errorf("снимок: %+v", snapshot)
+	}
+}
+
+func TestRestoreRejectsRunningMetronome(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	events := m.Subscribe()
+	m.Play()
+	defer m.Stop()
+	collect(t, clock, events, 1)
+
+	if err := m.Restore(m.GetState(), testLookup); err == nil {
+		t.Error("Restore запущенного метронома должен вернуть ошибку")
+	}
+}
+
+func TestRestoreRejectsPlayDuringLookup(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	defer m.Stop()
+
+	// Метроном запускается, пока Restore ищет паттерн
+	lookup := func(name string) (*Pattern, error) {
+		if err := m.Play(); err != nil {
+			t.Errorf("Play: %v", err)
+		}
+		return testLookup(name)
+	}
+	st := State{BPM: 60, TimeSignature: CommonTime(4), Pattern: "waltz"}
+	if err := m.Restore(st, lookup); err == nil {
+		t.Error("Restore запущенного метронома должен вернуть ошибку")
+	}
+	if snapshot := m.GetState(); snapshot.BPM != 120 || snapshot.Pattern != "basic" {
+		t.Errorf("настройки играющего метронома изменены: %+v", snapshot)
+	}
+}
@@ -0,0 +1,56 @@
+package metronome
+
+import "fmt"
+
+// SubdivisionVoice - звук и громкость одного уровня подразделения
+type SubdivisionVoice struct {
+	Sound  string  `json:"sound"`
+	Volume float64 `json:"volume"`
+}
+
+// DefaultSubdivisionVoices - звуки уровней подразделения по умолчанию.
+// Ключ - уровень: 2 - восьмые, 3 - триоли, 4 - шестнадцатые и т.д.
+var DefaultSubdivisionVoices = map[int]SubdivisionVoice{
+	2: {Sound: "eighth", Volume: 0.5},
+	3: {Sound: "triplet", Volume: 0.45},
+	4: {Sound: "sixteenth", Volume: 0.35},
+	5: {Sound: "quintuplet", Volume: 0.4},
+	6: {Sound: "sextuplet", Volume: 0.35},
+	7: {Sound: "septuplet", Volume: 0.35},
+	8: {Sound: "thirtysecond", Volume: 0.3},
+}
+
+// MaxSubdivision - наибольшее поддерживаемое деление доли
+const MaxSubdivision = 8
+
+// ValidateSubdivision проверяет деление доли (0 и 1 - без подразделений)
+func ValidateSubdivision(n int) error {
+	if n < 0 || n > MaxSubdivision {
+		return fmt.Errorf("подразделение должно быть от 1 до %d", MaxSubdivision)
+	}
+	return nil
+}
+
+// subdivisionLevel возвращает уровень, к которому относится удар sub из n
+// равных частей доли. Например, третий удар из четырех (sub = 2) совпадает
+// с восьмой, а второй и четвертый - шестнадцатые.
+func subdivisionLevel(sub, n int) int {
+	for level := 2; level < n; level++ {
+		if n%level == 0 && sub*level%n == 0 {
+			return level
+		}
+	}
+	return n
+}
+
+// subdivisionVoice возвращает звук уровня подразделения: из паттерна,
+// а если он там не задан - по умолчанию
+func (p *Pattern) subdivisionVoice(level int) SubdivisionVoice {
+	if voice, ok := p.Subdivisions[level]; ok {
+		return voice
+	}
+	if voice, ok := DefaultSubdivisionVoices[level]; ok {
+		return voice
+	}
+	return SubdivisionVoice{Sound: "ghost", Volume: 0.4}
+}
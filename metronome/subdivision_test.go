@@ -0,0 +1,126 @@
+package metronome
+
+import (
+	"slices"
+	"testing"
+)
+
+// click - удар с позицией в семплах
+type click struct {
+	Beat    int
+	SubBeat int
+	Sound   string
+	Sample  int64
+}
+
+func clicks(seq *sequencer, n int) []click {
+	out := make([]click, n)
+	for i := range out {
+		e := seq.next()
+		out[i] = click{Beat: e.Beat, SubBeat: e.SubBeat, Sound: e.Sound, Sample: e.sample}
+	}
+	return out
+}
+
+func TestSubdivisionLevel(t *testing.T) {
+	// Удары шестнадцатых: второй совпадает с восьмой, остальные - свои
+	for _, tc := range []struct{ sub, n, want int }{
+		{1, 2, 2}, {1, 3, 3}, {2, 3, 3},
+		{1, 4, 4}, {2, 4, 2}, {3, 4, 4},
+		{2, 6, 3}, {3, 6, 2}, {1, 6, 6},
+		{4, 8, 2}, {2, 8, 4}, {1, 8, 8},
+	} {
+		if got := subdivisionLevel(tc.sub, tc.n); got != tc.want {
+			t.Errorf("subdivisionLevel(%d, %d) = %d, ожидалось %d", tc.sub, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestSubdivisionOffsets(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetSubdivision(4); err != nil {
+		t.Fatalf("SetSubdivision: %v", err)
+	}
+
+	// При 120 BPM доля - 22050 семплов, шестнадцатая - 5512.5
+	want := []click{
+		{1, 0, "accent", 0},
+		{1, 1, "sixteenth", 5513},
+		{1, 2, "eighth", 11025},
+		{1, 3, "sixteenth", 16538},
+		{2, 0, "normal", 22050},
+		{2, 1, "sixteenth", 27563},
+		{2, 2, "eighth", 33075},
+		{2, 3, "sixteenth", 38588},
+	}
+	if got := clicks(m.newSequencer(), len(want)); !slices.Equal(got, want) {
+		t.Errorf("удары:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestPatternBeatSubdivision(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	m.Pattern = &Pattern{
+		Beats: 4,
+		Pattern: []BeatDefinition{
+			{Beat: 1, Sound: "accent", Volume: 1.0},
+			{Beat: 2, Sound: "normal", Volume: 0.7, Subdiv: 3},
+		},
+		Subdivisions: map[int]SubdivisionVoice{3: {Sound: "rim", Volume: 0.2}},
+	}
+
+	// Триоль только на второй доле, звуком паттерна
+	want := []click{
+		{1, 0, "accent", 0},
+		{2, 0, "normal", 22050},
+		{2, 1, "rim", 29400},
+		{2, 2, "rim", 36750},
+		{3, 0, "normal", 44100},
+	}
+	if got := clicks(m.newSequencer(), len(want)); !slices.Equal(got, want) {
+		t.Errorf("удары:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestSubdivisionTempoChangeMidBar(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetSubdivision(2); err != nil {
+		t.Fatalf("SetSubdivision: %v", err)
+	}
+	seq := m.newSequencer()
+	clicks(seq, 4)
+
+	// С третьей доли темп вдвое медленнее: восьмые растягиваются вместе
+	// с долей, а прошлые удары не сдвигаются
+	seq.changeTempo(60)
+	want := []click{
+		{3, 0, "normal", 44100},
+		{3, 1, "eighth", 66150},
+		{4, 0, "normal", 88200},
+		{4, 1, "eighth", 110250},
+		{1, 0, "accent", 132300},
+	}
+	if got := clicks(seq, len(want)); !slices.Equal(got, want) {
+		t.Errorf("удары после смены темпа:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestSubdivisionCarriesTempoFlagOnce(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetSubdivision(3); err != nil {
+		t.Fatalf("SetSubdivision: %v", err)
+	}
+	seq := m.newSequencer()
+	seq.next()
+	seq.next()
+	seq.next()
+	seq.changeTempo(90)
+
+	main, sub := seq.next(), seq.next()
+	if !main.TempoChanged || main.Tempo != 90 {
+		t.Errorf("доля после смены: TempoChanged %v, темп %v", main.TempoChanged, main.Tempo)
+	}
+	if sub.TempoChanged || sub.SubBeat != 1 || sub.Subdivision != 3 {
+		t.Errorf("подразделение: TempoChanged %v, SubBeat %d из %d", sub.TempoChanged, sub.SubBeat, sub.Subdivision)
+	}
+}
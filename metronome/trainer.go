@@ -0,0 +1,154 @@
+package metronome
+
+import "fmt"
+
+// TrainerConfig описывает тренажер скорости: темп растет на Step BPM
+// каждые Interval тактов, пока не достигнет Target.
+type TrainerConfig struct {
+	Start    int  `json:"start"`    // Начальный темп
+	Step     int  `json:"step"`     // Прибавка темпа за шаг (BPM)
+	Interval int  `json:"interval"` // Количество тактов на каждом темпе
+	Target   int  `json:"target"`   // Целевой темп
+	Repeat   int  `json:"repeat"`   // Количество циклов разгона (0 - бесконечно)
+	CoolDown bool `json:"cooldown"` // После цели постепенно вернуться к начальному темпу
+}
+
+// TrainerPhase - фаза тренажера
+type TrainerPhase string
+
+const (
+	TrainerBuild    TrainerPhase = "build"    // Разгон к целевому темпу
+	TrainerCoolDown TrainerPhase = "cooldown" // Возврат к начальному темпу
+	TrainerDone     TrainerPhase = "done"     // Все циклы пройдены
+)
+
+// TrainerStatus - состояние тренажера, передаваемое подписчикам
+type TrainerStatus struct {
+	Phase    TrainerPhase `json:"phase"`
+	Cycle    int          `json:"cycle"`  // Текущий цикл (1-based)
+	Cycles   int          `json:"cycles"` // Всего циклов (0 - бесконечно)
+	Tempo    int          `json:"tempo"`  // Текущий темп тренажера
+	Start    int          `json:"start"`
+	Target   int          `json:"target"`
+	Bar      int          `json:"bar"` // Такт на текущем темпе (1..Interval)
+	Interval int          `json:"interval"`
+}
+
+// Progress возвращает пройденную долю пути от начального темпа к целевому
+func (s TrainerStatus) Progress() float64 {
+	if s.Target == s.Start {
+		return 1
+	}
+	return float64(s.Tempo-s.Start) / float64(s.Target-s.Start)
+}
+
+// Validate проверяет настройки тренажера
+func (c TrainerConfig) Validate() error {
+	if c.Start < 20 || c.Start > 300 || c.Target < 20 || c.Target > 300 {
+		return fmt.Errorf("темпы тренажера должны быть от 20 до 300")
+	}
+	if c.Step == 0 {
+		return fmt.Errorf("шаг тренажера не может быть нулевым")
+	}
+	if (c.Target-c.Start)*c.Step < 0 {
+		return fmt.Errorf("шаг %d не ведет от %d к %d BPM", c.Step, c.Start, c.Target)
+	}
+	if c.Interval < 1 {
+		return fmt.Errorf("интервал тренажера должен быть не меньше одного такта")
+	}
+	if c.Repeat < 0 {
+		return fmt.Errorf("количество повторов не может быть отрицательным")
+	}
+	return nil
+}
+
+// trainerState ведет тренажер внутри секвенсора
+type trainerState struct {
+	cfg     TrainerConfig
+	phase   TrainerPhase
+	cycle   int
+	tempo   int
+	bar     int // Такт на текущем темпе
+	started bool
+}
+
+func newTrainerState(cfg TrainerConfig) *trainerState {
+	return &trainerState{
+		cfg:   cfg,
+		phase: TrainerBuild,
+		cycle: 1,
+		tempo: cfg.Start,
+	}
+}
+
+// onBar вызывается на первой доле каждого такта. Возвращает темп для
+// начинающегося такта и признак того, что темп изменился.
+func (t *trainerState) onBar() (int, bool) {
+	if !t.started {
+		t.started = true
+		t.bar = 1
+		return t.tempo, false
+	}
+	if t.phase == TrainerDone || t.bar < t.cfg.Interval {
+		t.bar++
+		return t.tempo, false
+	}
+
+	t.bar = 1
+	previous := t.tempo
+
+	switch t.phase {
+	case TrainerBuild:
+		if t.tempo != t.cfg.Target {
+			t.tempo = t.stepToward(t.cfg.Target, t.cfg.Step)
+			break
+		}
+		// Целевой темп отыгран
+		if t.cfg.CoolDown {
+			t.phase = TrainerCoolDown
+			t.tempo = t.stepToward(t.cfg.Start, -t.cfg.Step)
+		} else {
+			t.nextCycle()
+		}
+	case TrainerCoolDown:
+		t.tempo = t.stepToward(t.cfg.Start, -t.cfg.Step)
+		if t.tempo == t.cfg.Start {
+			t.nextCycle()
+		}
+	}
+
+	return t.tempo, t.tempo != previous
+}
+
+// nextCycle начинает следующий цикл разгона или завершает тренажер
+func (t *trainerState) nextCycle() {
+	if t.cfg.Repeat > 0 && t.cycle >= t.cfg.Repeat {
+		t.phase = TrainerDone
+		return
+	}
+	t.cycle++
+	t.phase = TrainerBuild
+	t.tempo = t.cfg.Start
+}
+
+// stepToward сдвигает темп на step, не перескакивая limit
+func (t *trainerState) stepToward(limit, step int) int {
+	tempo := t.tempo + step
+	if (step > 0 && tempo > limit) || (step < 0 && tempo < limit) {
+		return limit
+	}
+	return tempo
+}
+
+func (t *trainerState) status() *TrainerStatus {
+	return &TrainerStatus{
+		Phase:    t.phase,
+		Cycle:    t.cycle,
+		Cycles:   t.cfg.Repeat,
+		Tempo:    t.tempo,
+		Start:    t.cfg.Start,
+		Target:   t.cfg.Target,
+		Bar:      t.bar,
+		Interval: t.cfg.Interval,
+	}
+}
@@ -0,0 +1,119 @@
+package metronome
+
+import (
+	"slices"
+	"testing"
+)
+
+// trainerBars возвращает темп и состояние тренажера на первой доле
+// каждого из n тактов
+func trainerBars(t *testing.T, cfg TrainerConfig, n int) ([]float64, []*TrainerStatus) {
+	t.Helper()
+
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	if err := m.SetTrainer(cfg); err != nil {
+		t.Fatalf("SetTrainer: %v", err)
+	}
+
+	var tempos []float64
+	var statuses []*TrainerStatus
+	seq := m.newSequencer()
+	for len(tempos) < n {
+		e := seq.next()
+		if e.Beat == 1 && e.SubBeat == 0 {
+			tempos = append(tempos, e.Tempo)
+			statuses = append(statuses, e.Trainer)
+		}
+	}
+	return tempos, statuses
+}
+
+func TestTrainerStepsEveryInterval(t *testing.T) {
+	tempos, statuses := trainerBars(t, TrainerConfig{Start: 100, Step: 10, Interval: 2, Target: 130}, 10)
+
+	// Каждый темп держится два такта; после цели - новый цикл с начала
+	want := []float64{100, 100, 110, 110, 120, 120, 130, 130, 100, 100}
+	if !slices.Equal(tempos, want) {
+		t.Errorf("темпы по тактам: %v, ожидалось %v", tempos, want)
+	}
+	if s := statuses[2]; s.Bar != 1 || s.Interval != 2 || s.Phase != TrainerBuild || s.Cycle != 1 {
+		t.Errorf("состояние в такте 3: %+v", s)
+	}
+	if s := statuses[8]; s.Cycle != 2 || s.Tempo != 100 {
+		t.Errorf("второй цикл: %+v", s)
+	}
+}
+
+func TestTrainerStopsAtTarget(t *testing.T) {
+	// Шаг не делится на разницу темпов: последний шаг упирается в цель
+	tempos, statuses := trainerBars(t, TrainerConfig{Start: 100, Step: 15, Interval: 1, Target: 130, Repeat: 1}, 6)
+
+	want := []float64{100, 115, 130, 130, 130, 130}
+	if !slices.Equal(tempos, want) {
+		t.Errorf("темпы по тактам: %v, ожидалось %v", tempos, want)
+	}
+	if s := statuses[len(statuses)-1]; s.Phase != TrainerDone || s.Progress() != 1 {
+		t.Errorf("после цели: %+v", s)
+	}
+}
+
+func TestTrainerCoolDown(t *testing.T) {
+	tempos, statuses := trainerBars(t, TrainerConfig{Start: 100, Step: 10, Interval: 1, Target: 120, Repeat: 1, CoolDown: true}, 7)
+
+	want := []float64{100, 110, 120, 110, 100, 100, 100}
+	if !slices.Equal(tempos, want) {
+		t.Errorf("темпы по тактам: %v, ожидалось %v", tempos, want)
+	}
+	if statuses[3].Phase != TrainerCoolDown {
+		t.Errorf("такт 4: фаза %s, ожидалась cooldown", statuses[3].Phase)
+	}
+	if statuses[4].Phase != TrainerDone {
+		t.Errorf("такт 5: фаза %s, ожидалась done", statuses[4].Phase)
+	}
+}
+
+func TestTrainerValidate(t *testing.T) {
+	for _, bad := range []TrainerConfig{
+		{Start: 100, Step: 0, Interval: 1, Target: 120},
+		{Start: 100, Step: -5, Interval: 1, Target: 120},
+		{Start: 100, Step: 5, Interval: 0, Target: 120},
+		{Start: 10, Step: 5, Interval: 1, Target: 120},
+		{Start: 100, Step: 5, Interval: 1, Target: 120, Repeat: -1},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) должен вернуть ошибку", bad)
+		}
+	}
+}
+
+func TestRestoreReplaysTrainer(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	cfg := TrainerConfig{Start: 90, Step: 5, Interval: 4, Target: 120}
+	st := State{
+		Bar:           9,
+		BPM:           90,
+		TimeSignature: CommonTime(4),
+		Pattern:       "basic",
+		Trainer:       &cfg,
+	}
+	if err := m.Restore(st, testLookup); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if m.BPM != 90 {
+		t.Errorf("BPM после Restore %d, ожидалось начальное 90", m.BPM)
+	}
+
+	// Тренажер начинается заново и к такту 9 проходит два шага
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	defer m.Stop()
+	e := collect(t, clock, events, 1)[0]
+	if e.Bar != 9 || e.Tempo != 100 {
+		t.Errorf("первая доля после Restore: такт %d, темп %v; ожидался такт 9, 100 BPM", e.Bar, e.Tempo)
+	}
+	if e.Trainer == nil || e.Trainer.Bar != 1 || e.Trainer.Tempo != 100 {
+		t.Errorf("состояние тренажера: %+v", e.Trainer)
+	}
+}
@@ -0,0 +1,349 @@
+package metronome
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// TransportState - состояние воспроизведения метронома
+type TransportState int
+
+const (
+	TransportStopped TransportState = iota // Остановлен, следующая игра - с начала
+	TransportPlaying                       // Играет
+	TransportPaused                        // На паузе, позиция сохранена
+)
+
+func (s TransportState) String() string {
+	switch s {
+	case TransportPlaying:
+		return "playing"
+	case TransportPaused:
+		return "paused"
+	default:
+		return "stopped"
+	}
+}
+
+// MarshalText сохраняет состояние строкой "playing"
+func (s TransportState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText читает состояние из строки "playing"
+func (s *TransportState) UnmarshalText(data []byte) error {
+	switch string(data) {
+	case "playing":
+		*s = TransportPlaying
+	case "paused":
+		*s = TransportPaused
+	case "stopped":
+		*s = TransportStopped
+	default:
+		return fmt.Errorf("неизвестное состояние воспроизведения %q", data)
+	}
+	return nil
+}
+
+// Transport возвращает текущее состояние воспроизведения
+func (m *Metronome) Transport() TransportState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Start запускает метроном (то же, что Play)
+func (m *Metronome) Start() error {
+	return m.Play()
+}
+
+// Play начинает воспроизведение: с начала, с позиции, выбранной через Seek,
+// или, если метроном на паузе, с места остановки
+func (m *Metronome) Play() error {
+	m.mu.Lock()
+	err := m.play()
+	m.mu.Unlock()
+	m.flush()
+	return err
+}
+
+// play запускает воспроизведение. Вызывается под m.mu.
+func (m *Metronome) play() error {
+	if m.ensemble != nil {
+		return errInEnsemble
+	}
+	switch m.state {
+	case TransportPlaying:
+		return fmt.Errorf("метроном уже запущен")
+	case TransportPaused:
+		m.resume()
+		m.emit(Started{Resumed: true, Bar: m.barCount, Beat: m.beatCount, Timestamp: m.clock.Now()})
+		return nil
+	}
+
+	// Остановленный метроном можно запускать снова
+	select {
+	case <-m.done:
+		m.done = make(chan struct{})
+	default:
+	}
+
+	if m.seq != nil {
+		// Позиция выбрана через Seek
+		m.stats = &sessionStats{}
+		m.resume()
+		m.emit(Started{Bar: m.barCount, Beat: m.beatCount + 1, Timestamp: m.clock.Now()})
+		return nil
+	}
+	m.begin(m.clock.Now())
+
+	if m.out != nil {
+		if err := m.out.Start(0); err != nil {
+			fmt.Fprintf(m.progress, "Аудио недоступно: %v\n", err)
+			m.out = nil
+		}
+	}
+	m.startRun()
+
+	return nil
+}
+
+// begin начинает воспроизведение с первой доли на временной шкале,
+// отсчитываемой от start. Вызывается под m.mu.
+func (m *Metronome) begin(start time.Time) {
+	m.state = TransportPlaying
+	m.Running = true
+
+	m.seq = m.newSequencer()
+	m.pending = nil
+	m.beatCount = 0
+	m.barCount = 1
+	m.tempo = m.seq.tempo
+	m.lastPattern = m.Pattern
+	m.startTime = start
+	m.stats = &sessionStats{}
+	m.emit(Started{Bar: 1, Beat: 1, Timestamp: start})
+}
+
+// Pause приостанавливает воспроизведение, запоминая позицию. Подписчики
+// остаются подписанными и получат доли после Resume.
+func (m *Metronome) Pause() error {
+	m.mu.Lock()
+	if m.ensemble != nil {
+		m.mu.Unlock()
+		return errInEnsemble
+	}
+	if m.state != TransportPlaying {
+		m.mu.Unlock()
+		return fmt.Errorf("метроном не играет")
+	}
+
+	m.pausedAt = m.clock.Now().Sub(m.startTime)
+	m.state = TransportPaused
+	m.Running = false
+	m.halt()
+	out := m.out
+	m.emit(Stopped{Paused: true, Timestamp: m.clock.Now()})
+	m.mu.Unlock()
+	m.flush()
+
+	// Уже запланированные щелчки отбрасываются вместе с потоком
+	if out != nil {
+		out.Stop()
+	}
+
+	return nil
+}
+
+// Resume продолжает воспроизведение с места паузы
+func (m *Metronome) Resume() error {
+	m.mu.Lock()
+	if m.ensemble != nil {
+		m.mu.Unlock()
+		return errInEnsemble
+	}
+	if m.state != TransportPaused {
+		m.mu.Unlock()
+		return fmt.Errorf("метроном не на паузе")
+	}
+	m.resume()
+	m.emit(Started{Resumed: true, Bar: m.barCount, Beat: m.beatCount, Timestamp: m.clock.Now()})
+	m.mu.Unlock()
+	m.flush()
+
+	return nil
+}
+
+// resume запускает игру с позиции pausedAt. Доли, запланированные до паузы,
+// заново ставятся в новый аудиопоток. Вызывается под m.mu.
+func (m *Metronome) resume() {
+	m.startTime = m.clock.Now().Add(-m.pausedAt)
+	m.state = TransportPlaying
+	m.Running = true
+
+	if m.out != nil {
+		if err := m.out.Start(durationToSamples(m.pausedAt)); err != nil {
+			fmt.Fprintf(m.progress, "Аудио недоступно: %v\n", err)
+			m.out = nil
+		}
+	}
+	for i := range m.pending {
+		m.pending[i].Timestamp = m.startTime.Add(m.pending[i].Offset)
+		// Доли до паузы уже прозвучали, их ждут только подписчики
+		if m.out != nil && m.pending[i].Offset >= m.pausedAt {
+			m.out.Schedule(m.pending[i])
+		}
+	}
+
+	m.startRun()
+}
+
+// Stop останавливает воспроизведение. Следующий Play начнет с начала.
+// Каналы Subscribe закрываются; подписки SubscribeEvents остаются, а об
+// остановке сообщает канал Done.
+func (m *Metronome) Stop() {
+	m.stop(false)
+}
+
+// stop останавливает воспроизведение; finished - песня или сессия доиграна
+// до конца
+func (m *Metronome) stop(finished bool) {
+	m.mu.Lock()
+	if m.state == TransportStopped {
+		m.mu.Unlock()
+		return
+	}
+
+	switch {
+	case finished:
+		// Доиграно до конца - время по шкале, а не по часам
+		m.stats.played = m.seq.offset()
+	case m.state == TransportPaused:
+		m.stats.played = m.pausedAt
+	default:
+		m.stats.played = m.clock.Now().Sub(m.startTime)
+	}
+	m.stats.summary.Finished = finished
+	m.state = TransportStopped
+	m.Running = false
+	m.halt()
+	m.seq = nil
+	m.pending = nil
+	close(m.done)
+	out := m.out
+	m.emit(Stopped{Finished: finished, Timestamp: m.clock.Now()})
+	m.mu.Unlock()
+	m.flush()
+	m.closeSubscribers()
+
+	if out != nil {
+		out.Stop()
+	}
+}
+
+// Seek переходит к доле beat такта bar. Во время игры воспроизведение
+// сразу продолжается с новой позиции, на паузе - после Resume, а у
+// остановленного метронома позиция запоминается до Play. Переход темпа,
+// тренажер и песня проходят путь до этой доли так же, как при игре.
+func (m *Metronome) Seek(bar, beat int) error {
+	if bar < 1 || beat < 1 {
+		return fmt.Errorf("такт и доля начинаются с 1")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.seek(bar, beat)
+}
+
+// seek переходит к доле beat такта bar. Вызывается под m.mu.
+func (m *Metronome) seek(bar, beat int) error {
+	if m.ensemble != nil {
+		return errInEnsemble
+	}
+	seq := m.newSequencer()
+	var target TickEvent
+	for {
+		if seq.finished() {
+			return fmt.Errorf("такт %d, доля %d - за пределами песни", bar, beat)
+		}
+		event := seq.next()
+		if event.CountIn || event.SubBeat > 0 || event.LayerOnly {
+			continue
+		}
+		if event.Bar > bar || (event.Bar == bar && event.Beat > beat) {
+			return fmt.Errorf("в такте %d нет доли %d", bar, beat)
+		}
+		if event.Bar == bar && event.Beat == beat {
+			target = event
+			break
+		}
+	}
+
+	playing := m.state == TransportPlaying
+	if playing {
+		m.halt()
+		if m.out != nil {
+			m.out.Stop()
+		}
+	}
+
+	m.seq = seq
+	m.pending = []TickEvent{target}
+	m.tempo = target.Tempo
+	m.lastPattern = target.pattern
+	m.pausedAt = target.Offset
+	m.beatCount = max(beat-1, 0)
+	m.barCount = bar
+
+	if playing {
+		m.resume()
+	}
+
+	return nil
+}
+
+// Done возвращает канал, закрываемый при остановке метронома, в том
+// числе когда песня доиграна до конца
+func (m *Metronome) Done() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.done
+}
+
+// startRun запускает цикл планировщика. Вызывается под m.mu.
+func (m *Metronome) startRun() {
+	m.quit = make(chan struct{})
+	go m.run(m.quit)
+}
+
+// halt останавливает цикл планировщика. Вызывается под m.mu.
+func (m *Metronome) halt() {
+	if m.quit != nil {
+		close(m.quit)
+		m.quit = nil
+	}
+}
+
+// run - цикл планировщика. Он просыпается к ближайшему событию: либо
+// к очередной доле, которую пора показать подписчикам, либо к следующему
+// планированию звука наперед.
+func (m *Metronome) run(quit <-chan struct{}) {
+	timer := m.clock.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+			timer.Reset(m.schedule())
+		case <-quit:
+			return
+		}
+	}
+}
+
+// durationToSamples переводит время в позицию в семплах
+func durationToSamples(d time.Duration) int64 {
+	return int64(math.Round(d.Seconds() * float64(sampleRate)))
+}
@@ -0,0 +1,175 @@
+package metronome
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrigCondition - условие срабатывания доли, как у тригов драм-машин.
+// Записывается строкой из условий через пробел, срабатывают все сразу:
+//
+//	"60%"    - с вероятностью 60%
+//	"2:4"    - только на втором проходе цикла из каждых четырех
+//	"first"  - только на первом проходе, "!first" - кроме него
+//	"last"   - только в последнем такте цикла, "!last" - кроме него
+//
+// Проход - один цикл паттерна (Cycle тактов, без цикла - один такт).
+type TrigCondition struct {
+	Probability float64 // Вероятность срабатывания (0.0-1.0); 0 - без случайности
+	Pass        int     // Номер прохода в повторе из Every (1-based)
+	Every       int     // Длина повтора в проходах; 0 - на каждом проходе
+	First       bool    // Только на первом проходе
+	NotFirst    bool    // Кроме первого прохода
+	Last        bool    // Только в последнем такте цикла
+	NotLast     bool    // Кроме последнего такта цикла
+}
+
+// ParseTrigCondition разбирает условие вида "!last 50%"
+func ParseTrigCondition(s string) (TrigCondition, error) {
+	var c TrigCondition
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return c, fmt.Errorf("пустое условие доли")
+	}
+
+	for _, f := range fields {
+		switch {
+		case f == "first":
+			c.First = true
+		case f == "!first":
+			c.NotFirst = true
+		case f == "last":
+			c.Last = true
+		case f == "!last":
+			c.NotLast = true
+		case strings.HasSuffix(f, "%"):
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(f, "%"), 64)
+			if err != nil || pct <= 0 || pct > 100 {
+				return c, fmt.Errorf("неверная вероятность %q: ожидается от 1%% до 100%%", f)
+			}
+			c.Probability = pct / 100
+		case strings.Contains(f, ":"):
+			pass, every, _ := strings.Cut(f, ":")
+			p, err1 := strconv.Atoi(pass)
+			e, err2 := strconv.Atoi(every)
+			if err1 != nil || err2 != nil || e < 1 || p < 1 || p > e {
+				return c, fmt.Errorf("неверный повтор %q: ожидается вида 2:4", f)
+			}
+			c.Pass, c.Every = p, e
+		default:
+			return c, fmt.Errorf("неизвестное условие %q", f)
+		}
+	}
+
+	if (c.First && c.NotFirst) || (c.Last && c.NotLast) {
+		return c, fmt.Errorf("условие %q противоречит само себе", s)
+	}
+	return c, nil
+}
+
+// String возвращает условие в записи ParseTrigCondition
+func (c TrigCondition) String() string {
+	var parts []string
+	if c.Every > 0 {
+		parts = append(parts, fmt.Sprintf("%d:%d", c.Pass, c.Every))
+	}
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{{c.First, "first"}, {c.NotFirst, "!first"}, {c.Last, "last"}, {c.NotLast, "!last"}} {
+		if flag.set {
+			parts = append(parts, flag.name)
+		}
+	}
+	if c.Probability > 0 {
+		parts = append(parts, strconv.FormatFloat(c.Probability*100, 'f', -1, 64)+"%")
+	}
+	return strings.Join(parts, " ")
+}
+
+// holds проверяет условие для такта barInCycle прохода pass; chance -
+// случайное число 0.0-1.0 для вероятности
+func (c TrigCondition) holds(pass, barInCycle, cycle int, chance float64) bool {
+	switch {
+	case c.Every > 0 && (pass-1)%c.Every != c.Pass-1:
+		return false
+	case c.First && pass != 1, c.NotFirst && pass == 1:
+		return false
+	case c.Last && barInCycle != cycle, c.NotLast && barInCycle == cycle:
+		return false
+	case c.Probability > 0 && chance >= c.Probability:
+		return false
+	}
+	return true
+}
+
+// trigState проверяет условия долей внутри секвенсора. Генератор
+// создается с зерном метронома, а если оно не задано - паттерна, поэтому
+// живое воспроизведение и WAV при одном зерне совпадают.
+type trigState struct {
+	seed  int64 // Зерно метронома; 0 - из паттерна
+	rng   *rand.Rand
+	conds map[string]*TrigCondition // Разобранные условия; nil - неверное
+}
+
+// condition возвращает разобранное условие s. Каждое условие разбирается
+// один раз за жизнь секвенсора, а паттерны при этом не меняются.
+func (t *trigState) condition(s string) *TrigCondition {
+	if c, ok := t.conds[s]; ok {
+		return c
+	}
+	if t.conds == nil {
+		t.conds = make(map[string]*TrigCondition)
+	}
+	var parsed *TrigCondition
+	if c, err := ParseTrigCondition(s); err == nil {
+		parsed = &c
+	}
+	t.conds[s] = parsed
+	return parsed
+}
+
+// plays решает, звучит ли доля def в такте bar паттерна (от его начала).
+// Случайное число берется для каждой доли с вероятностью, даже если
+// другие условия ее уже отбросили, чтобы последовательность при одном
+// зерне не зависела от номера прохода. Неверное условие (такой паттерн
+// отклоняет Validate) доле не мешает.
+func (t *trigState) plays(def BeatDefinition, bar int, pattern *Pattern) bool {
+	if def.Condition == "" {
+		return true
+	}
+	c := t.condition(def.Condition)
+	if c == nil {
+		return true
+	}
+
+	chance := 0.0
+	if c.Probability > 0 {
+		if t.rng == nil {
+			seed := t.seed
+			if seed == 0 {
+				seed = pattern.Seed
+			}
+			if seed == 0 {
+				seed = time.Now().UnixNano()
+			}
+			t.rng = rand.New(rand.NewSource(seed))
+		}
+		chance = t.rng.Float64()
+	}
+
+	cycle := max(pattern.CycleLength(), 1)
+	pass := (bar-1)/cycle + 1
+	return c.holds(pass, (bar-1)%cycle+1, cycle, chance)
+}
+
+// SetTrigSeed задает зерно вероятностных условий долей; 0 - зерно
+// паттерна или случайное. Действует со следующего запуска.
+func (m *Metronome) SetTrigSeed(seed int64) {
+	m.mu.Lock()
+	m.trigSeed = seed
+	m.mu.Unlock()
+}
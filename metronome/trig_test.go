@@ -0,0 +1,92 @@
+package metronome
+
+import "testing"
+
+func TestParseTrigCondition(t *testing.T) {
+	c, err := ParseTrigCondition("!last 2:4 60%")
+	if err != nil {
+		t.Fatalf("ParseTrigCondition: %v", err)
+	}
+	if c.Pass != 2 || c.Every != 4 || !c.NotLast || c.Probability != 0.6 {
+		t.Errorf("разобрано %+v", c)
+	}
+	if c.String() != "2:4 !last 60%" {
+		t.Errorf("String: %q", c.String())
+	}
+
+	for _, bad := range []string{"", "0%", "150%", "5:4", "0:2", "x:2", "first !first", "sometimes"} {
+		if _, err := ParseTrigCondition(bad); err == nil {
+			t.Errorf("ParseTrigCondition(%q) должен вернуть ошибку", bad)
+		}
+	}
+}
+
+func TestTrigConditionsByPass(t *testing.T) {
+	m, _ := newTestMetronome(t, 120, 4, "basic")
+	m.Pattern = &Pattern{
+		Beats: 4,
+		Cycle: 2,
+		Pattern: []BeatDefinition{
+			{Beat: 1, Sound: "accent", Volume: 1.0, Condition: "first"},
+			{Beat: 2, Sound: "normal", Volume: 0.7, Condition: "2:3"},
+			{Beat: 3, Sound: "normal", Volume: 0.7, Condition: "!last"},
+		},
+	}
+
+	// Цикл в два такта: проходы 1-3 занимают такты 1-6
+	want := map[int][]bool{
+		1: {true, false, true},
+		2: {true, false, false},
+		3: {false, true, true},
+		4: {false, true, false},
+		5: {false, false, true},
+		6: {false, false, false},
+	}
+	seq := m.newSequencer()
+	for bar := 1; bar <= 6; bar++ {
+		for beat := 1; beat <= 4; beat++ {
+			e := seq.next()
+			if beat == 4 {
+				continue
+			}
+			if e.Audible() != want[bar][beat-1] {
+				t.Errorf("такт %d, доля %d: звучит %v, ожидалось %v", bar, beat, e.Audible(), want[bar][beat-1])
+			}
+		}
+	}
+}
+
+func TestTrigProbabilityLiveMatchesRender(t *testing.T) {
+	m, clock := newTestMetronome(t, 120, 4, "basic")
+	pat := *m.Pattern
+	pat.Pattern = []BeatDefinition{{Beat: 2, Sound: "normal", Volume: 0.7, Condition: "50%"}}
+	m.Pattern = &pat
+	m.SetTrigSeed(11)
+
+	events := m.Subscribe()
+	if err := m.Play(); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	live := collect(t, clock, events, 40)
+	m.Stop()
+
+	// WAV берет удары из нового секвенсора с тем же зерном
+	seq := m.newSequencer()
+	played, skipped := 0, 0
+	for i, got := range live {
+		want := seq.next()
+		if got.Sound != want.Sound {
+			t.Errorf("удар %d: живой %q, в WAV %q", i, got.Sound, want.Sound)
+		}
+		if got.Beat == 2 {
+			if got.Audible() {
+				played++
+			} else {
+				skipped++
+			}
+		}
+	}
+	if played == 0 || skipped == 0 {
+		t.Errorf("вторая доля сыграна %d раз, пропущена %d", played, skipped)
+	}
+}
@@ -0,0 +1,282 @@
+package metronome
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError - ошибка в паттерне с путем к полю
+type ValidationError struct {
+	Path    string // Путь к полю в JSON, например "pattern[2].volume"
+	Line    int    // Строка JSON-файла; 0 - неизвестна
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("строка %d: %s: %s", e.Line, e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors - все ошибки паттерна в порядке полей
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// patternCheck накапливает ошибки проверки паттерна
+type patternCheck struct {
+	errs ValidationErrors
+}
+
+func (c *patternCheck) add(path, format string, args ...any) {
+	c.errs = append(c.errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *patternCheck) sound(path, sound string) {
+	if sound == "" {
+		c.add(path, "не указан звук")
+	} else if !KnownSound(sound) {
+		c.add(path, "неизвестный звук %q", sound)
+	}
+}
+
+func (c *patternCheck) volume(path string, volume float64) {
+	if volume < 0 || volume > 1 {
+		c.add(path, "громкость %g вне диапазона 0-1", volume)
+	}
+}
+
+// beats проверяет доли такта из n долей
+func (c *patternCheck) beats(path string, defs []BeatDefinition, n int) {
+	seen := make(map[int]bool)
+	for i, def := range defs {
+		at := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case def.Beat < 1 || def.Beat > n:
+			c.add(at+".beat", "доля %d вне такта из %d долей", def.Beat, n)
+		case seen[def.Beat]:
+			c.add(at+".beat", "доля %d определена повторно", def.Beat)
+		}
+		seen[def.Beat] = true
+
+		c.sound(at+".sound", def.Sound)
+		c.volume(at+".volume", def.Volume)
+		if err := ValidateSubdivision(def.Subdiv); err != nil {
+			c.add(at+".subdiv", "%v", err)
+		}
+		if def.Condition != "" {
+			if _, err := ParseTrigCondition(def.Condition); err != nil {
+				c.add(at+".condition", "%v", err)
+			}
+		}
+	}
+}
+
+// Validate проверяет паттерн. Возвращает ValidationErrors со всеми
+// найденными ошибками или nil.
+func (p *Pattern) Validate() error {
+	var c patternCheck
+
+	if p.Beats < 0 {
+		c.add("beats", "количество долей не может быть отрицательным")
+	}
+	if p.Meter != "" {
+		if _, err := ParseTimeSignature(p.Meter); err != nil {
+			c.add("meter", "%v", err)
+		}
+	}
+	if p.Grouping != "" {
+		if _, err := ParseGrouping(p.Grouping); err != nil {
+			c.add("grouping", "%v", err)
+		}
+	}
+	if p.BeatUnit != "" {
+		if _, err := ParseNoteValue(p.BeatUnit); err != nil {
+			c.add("beat_unit", "%v", err)
+		}
+	}
+	if p.Cycle < 0 {
+		c.add("cycle", "цикл не может быть отрицательным")
+	}
+
+	// В такте по умолчанию доли следующих тактов цикла можно нумеровать
+	// подряд (старая запись)
+	n := p.TimeSignature().Numerator
+	c.beats("pattern", p.Pattern, n*max(p.Cycle, 1))
+
+	bars := make(map[int]bool)
+	for i, bar := range p.Bars {
+		at := fmt.Sprintf("bars[%d]", i)
+		switch {
+		case bar.Bar < 1 || (p.Cycle > 0 && bar.Bar > p.Cycle):
+			c.add(at+".bar", "такт %d вне цикла из %d тактов", bar.Bar, p.CycleLength())
+		case bars[bar.Bar]:
+			c.add(at+".bar", "такт %d определен повторно", bar.Bar)
+		}
+		bars[bar.Bar] = true
+		c.beats(at+".pattern", bar.Pattern, n)
+	}
+
+	levels := make([]int, 0, len(p.Subdivisions))
+	for level := range p.Subdivisions {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	for _, level := range levels {
+		at := fmt.Sprintf("subdivisions.%d", level)
+		if level < 2 || level > MaxSubdivision {
+			c.add(at, "уровень подразделения должен быть от 2 до %d", MaxSubdivision)
+		}
+		c.sound(at+".sound", p.Subdivisions[level].Sound)
+		c.volume(at+".volume", p.Subdivisions[level].Volume)
+	}
+
+	for i, layer := range p.Layers {
+		at := fmt.Sprintf("layers[%d]", i)
+		if layer.Pulses < 1 {
+			c.add(at+".pulses", "у слоя должен быть хотя бы один удар")
+		}
+		if layer.Steps != "" {
+			if len(layer.Steps) != layer.Pulses {
+				c.add(at+".steps", "в маске %d шагов, а ударов %d", len(layer.Steps), layer.Pulses)
+			} else if strings.Trim(layer.Steps, "x.") != "" {
+				c.add(at+".steps", "маска может содержать только 'x' и '.'")
+			}
+		}
+		c.sound(at+".sound", layer.Sound)
+		c.volume(at+".volume", layer.Volume)
+	}
+
+	if p.Humanize != nil {
+		if err := p.Humanize.Validate(); err != nil {
+			c.add("humanize", "%v", err)
+		}
+	}
+	if p.Fill != nil {
+		if err := p.Fill.Validate(); err != nil {
+			c.add("fill", "%v", err)
+		} else if p.Fill.Every == 0 && p.CycleLength() < 2 {
+			c.add("fill.every", "у сбивки не задан период, а цикла у паттерна нет")
+		}
+	}
+
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	return nil
+}
+
+// ParsePattern разбирает и проверяет паттерн в JSON. Ошибки проверки
+// возвращаются как ValidationErrors с номерами строк.
+func ParsePattern(data []byte) (*Pattern, error) {
+	var pattern Pattern
+	if err := json.Unmarshal(data, &pattern); err != nil {
+		var syntax *json.SyntaxError
+		var typ *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntax):
+			return nil, fmt.Errorf("ошибка парсинга JSON (строка %d): %w", lineAt(data, syntax.Offset), err)
+		case errors.As(err, &typ):
+			// Offset указывает за конец значения
+			return nil, ValidationErrors{{Path: typ.Field, Line: lineAt(data, typ.Offset-1), Message: fmt.Sprintf("ожидается %s", typ.Type)}}
+		}
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+
+	if err := pattern.Validate(); err != nil {
+		var errs ValidationErrors
+		if errors.As(err, &errs) {
+			lines := jsonLines(data)
+			for i := range errs {
+				errs[i].Line = lookupLine(lines, errs[i].Path)
+			}
+		}
+		return nil, err
+	}
+	return &pattern, nil
+}
+
+// lookupLine возвращает строку поля path, а если его нет в файле -
+// строку ближайшего родителя
+func lookupLine(lines map[string]int, path string) int {
+	for {
+		if line, ok := lines[path]; ok {
+			return line
+		}
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			return lines[""]
+		}
+		path = path[:i]
+	}
+}
+
+// jsonLines сопоставляет путям полей JSON номера строк, где они начинаются
+func jsonLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		if _, ok := lines[path]; !ok {
+			lines[path] = lineAt(data, dec.InputOffset())
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				offset := dec.InputOffset()
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				child := fmt.Sprint(key)
+				if path != "" {
+					child = path + "." + child
+				}
+				lines[child] = lineAt(data, offset)
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(path + "[" + strconv.Itoa(i) + "]"); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+		}
+		return err
+	}
+	walk("")
+
+	return lines
+}
+
+// lineAt возвращает номер строки (1-based) первого значимого символа
+// начиная с offset: разделители перед ним пропускаются
+func lineAt(data []byte, offset int64) int {
+	offset = min(max(offset, 0), int64(len(data)))
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,63 @@
+package metronome
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPredefinedPatternsValid(t *testing.T) {
+	for name, pat := range PredefinedPatterns() {
+		if err := pat.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	pat, err := NewEuclidPattern("e", 8, EuclidLayer{Hits: 3, Steps: 8}, EuclidLayer{Hits: 5, Steps: 16, Sound: "rim", Volume: 0.5})
+	if err != nil {
+		t.Fatalf("NewEuclidPattern: %v", err)
+	}
+	if err := pat.Validate(); err != nil {
+		t.Errorf("евклидов паттерн: %v", err)
+	}
+}
+
+func TestParsePatternErrors(t *testing.T) {
+	data := []byte(`{
+  "name": "bad",
+  "beats": 4,
+  "pattern": [
+    {"beat": 1, "sound": "accent", "volume": 1.5},
+    {"beat": 1, "sound": "kick", "volume": 0.5},
+    {"beat": 9, "sound": "normal", "volume": 0.5}
+  ],
+  "bars": [{"bar": 1, "pattern": [{"beat": 2, "sound": "ghost", "volume": 0.3, "condition": "0%"}]}],
+  "cycle": -1
+}`)
+
+	_, err := ParsePattern(data)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("ожидались ValidationErrors, получено %v", err)
+	}
+
+	want := []ValidationError{
+		{Path: "cycle", Line: 10},
+		{Path: "pattern[0].volume", Line: 5},
+		{Path: "pattern[1].beat", Line: 6},
+		{Path: "pattern[1].sound", Line: 6},
+		{Path: "pattern[2].beat", Line: 7},
+		{Path: "bars[0].pattern[0].condition", Line: 9},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("ошибки: %v", errs)
+	}
+	for i, w := range want {
+		if errs[i].Path != w.Path || errs[i].Line != w.Line {
+			t.Errorf("ошибка %d: %s (строка %d), ожидалось %s (строка %d)", i, errs[i].Path, errs[i].Line, w.Path, w.Line)
+		}
+	}
+
+	if _, err := ParsePattern([]byte("{\n  \"beats\": \"4\"\n}")); !errors.As(err, &errs) || errs[0].Line != 2 {
+		t.Errorf("ошибка типа: %v", err)
+	}
+}
@@ -1,24 +1,58 @@
 package patterns
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"smart-metronome/config"
 	"smart-metronome/metronome"
 )
 
 var patternRegistry map[string]*metronome.Pattern
 
+// validName - допустимое имя пользовательского паттерна: оно же имя файла
+var validName = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+
 func init() {
 	patternRegistry = metronome.PredefinedPatterns()
 }
 
+// LoadPattern находит паттерн среди встроенных и зарегистрированных,
+// а затем в каталоге пользовательских паттернов. Сбивка паттерна
+// находится так же. Возвращается собственная копия паттерна, так что
+// реестр вызывающий не затрагивает.
 func LoadPattern(name string) (*metronome.Pattern, error) {
-	pattern, exists := patternRegistry[name]
-	if !exists {
-		return nil, fmt.Errorf("паттерн '%s' не найден", name)
+	found, err := findPattern(name)
+	if err != nil {
+		return nil, err
+	}
+	pattern := found.Clone()
+	if err := pattern.Resolve(findPattern); err != nil {
+		return nil, err
 	}
 	return pattern, nil
 }
 
+// findPattern ищет паттерн по имени, не разрешая его сбивку
+func findPattern(name string) (*metronome.Pattern, error) {
+	if pattern, exists := patternRegistry[name]; exists {
+		return pattern, nil
+	}
+
+	if filename, err := userFile(name); err == nil {
+		if _, err := os.Stat(filename); err == nil {
+			return metronome.LoadPatternFromFile(filename)
+		}
+	}
+
+	return nil, fmt.Errorf("паттерн '%s' не найден", name)
+}
+
 func GetAllPatterns() map[string]string {
 	result := make(map[string]string)
 	for name, pattern := range patternRegistry {
@@ -31,6 +65,9 @@ func RegisterPattern(name string, pattern *metronome.Pattern) error {
 	if _, exists := patternRegistry[name]; exists {
 		return fmt.Errorf("паттерн '%s' уже существует", name)
 	}
+	if err := pattern.Validate(); err != nil {
+		return fmt.Errorf("паттерн '%s': %w", name, err)
+	}
 	patternRegistry[name] = pattern
 	return nil
 }
@@ -43,12 +80,213 @@ func GetPatternNames() []string {
 	return names
 }
 
+// SaveCustomPattern создает паттерн и сохраняет его в каталог
+// пользователя, так что он доступен и после перезапуска
 func SaveCustomPattern(name, description string, beats int, patternDef []metronome.BeatDefinition) error {
+	if _, err := findPattern(name); err == nil {
+		return fmt.Errorf("паттерн '%s' уже существует", name)
+	}
+
 	pattern := &metronome.Pattern{
 		Name:        name,
 		Description: description,
 		Beats:       beats,
 		Pattern:     patternDef,
 	}
-	return RegisterPattern(name, pattern)
+	_, err := SaveUserPattern(pattern)
+	return err
+}
+
+// IsBuiltin сообщает, встроенный ли паттерн name
+func IsBuiltin(name string) bool {
+	_, builtin := metronome.PredefinedPatterns()[name]
+	return builtin
+}
+
+// UserDir возвращает каталог пользовательских паттернов
+func UserDir() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "patterns"), nil
+}
+
+// userFile возвращает путь к файлу пользовательского паттерна name
+func userFile(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("имя паттерна '%s' может содержать только буквы, цифры, '-' и '_'", name)
+	}
+	if IsBuiltin(name) {
+		return "", fmt.Errorf("паттерн '%s' встроенный, выберите другое имя", name)
+	}
+
+	dir, err := UserDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// SaveUserPattern сохраняет паттерн в каталог пользовательских паттернов
+// под его именем и регистрирует его. Возвращает путь к файлу. Встроенные
+// паттерны перезаписать нельзя.
+func SaveUserPattern(pattern *metronome.Pattern) (string, error) {
+	filename, err := userFile(pattern.Name)
+	if err != nil {
+		return "", err
+	}
+	if err := pattern.Validate(); err != nil {
+		return "", fmt.Errorf("паттерн '%s': %w", pattern.Name, err)
+	}
+
+	if err := pattern.SavePatternToFile(filename); err != nil {
+		return "", err
+	}
+	patternRegistry[pattern.Name] = pattern
+	return filename, nil
+}
+
+// LoadUserPatterns регистрирует паттерны из каталога пользователя рядом
+// со встроенными и разрешает их сбивки. Файлы с именами встроенных
+// паттернов, файлы с ошибками и паттерны с ненайденной сбивкой пропускаются;
+// их ошибки возвращаются, чтобы о них можно было сообщить.
+func LoadUserPatterns() []error {
+	dir, err := UserDir()
+	if err != nil {
+		return []error{err}
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return []error{fmt.Errorf("ошибка чтения каталога паттернов: %w", err)}
+	}
+
+	var errs []error
+	loaded := make(map[string]string)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		filename := filepath.Join(dir, entry.Name())
+		if IsBuiltin(name) {
+			errs = append(errs, fmt.Errorf("%s: имя занято встроенным паттерном", filename))
+			continue
+		}
+
+		pattern, err := metronome.LoadPatternFromFile(filename)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		patternRegistry[name] = pattern
+		loaded[name] = filename
+	}
+
+	// Сбивки разрешаются, когда зарегистрированы все файлы: сбивкой
+	// может быть другой пользовательский паттерн
+	names := make([]string, 0, len(loaded))
+	for name := range loaded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := patternRegistry[name].Resolve(findPattern); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", loaded[name], err))
+			delete(patternRegistry, name)
+		}
+	}
+	return errs
+}
+
+// ImportPattern копирует паттерн из файла в каталог пользователя под
+// именем name (пусто - имя из файла). Существующий пользовательский
+// паттерн заменяется только при replace. Возвращает путь к копии.
+func ImportPattern(filename, name string, replace bool) (*metronome.Pattern, string, error) {
+	pattern, err := metronome.LoadPatternFromFile(filename)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if name == "" {
+		name = pattern.Name
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	pattern.Name = name
+
+	target, err := userFile(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := os.Stat(target); err == nil && !replace {
+		return nil, "", fmt.Errorf("паттерн '%s' уже есть в библиотеке", name)
+	}
+	if err := pattern.Resolve(findPattern); err != nil {
+		return nil, "", err
+	}
+
+	saved, err := SaveUserPattern(pattern)
+	return pattern, saved, err
+}
+
+// DeleteUserPattern удаляет паттерн из каталога пользователя
+func DeleteUserPattern(name string) error {
+	if IsBuiltin(name) {
+		return fmt.Errorf("паттерн '%s' встроенный, его нельзя удалить", name)
+	}
+	filename, err := userFile(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filename); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("пользовательский паттерн '%s' не найден", name)
+	} else if err != nil {
+		return fmt.Errorf("ошибка удаления паттерна: %w", err)
+	}
+	delete(patternRegistry, name)
+	return nil
+}
+
+// RenameUserPattern переименовывает паттерн в каталоге пользователя.
+// Возвращает путь к новому файлу.
+func RenameUserPattern(oldName, newName string) (string, error) {
+	if IsBuiltin(oldName) {
+		return "", fmt.Errorf("паттерн '%s' встроенный, его нельзя переименовать", oldName)
+	}
+	oldFile, err := userFile(oldName)
+	if err != nil {
+		return "", err
+	}
+	newFile, err := userFile(newName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := findPattern(newName); err == nil {
+		return "", fmt.Errorf("паттерн '%s' уже существует", newName)
+	}
+
+	if _, err := os.Stat(oldFile); errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("пользовательский паттерн '%s' не найден", oldName)
+	}
+	pattern, err := metronome.LoadPatternFromFile(oldFile)
+	if err != nil {
+		return "", err
+	}
+
+	// Имя хранится и в самом файле, поэтому он записывается заново
+	pattern.Name = newName
+	if _, err := SaveUserPattern(pattern); err != nil {
+		return "", err
+	}
+	if err := os.Remove(oldFile); err != nil {
+		return "", fmt.Errorf("ошибка удаления старого файла: %w", err)
+	}
+	delete(patternRegistry, oldName)
+	return newFile, nil
 }
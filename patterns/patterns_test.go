@@ -0,0 +1,164 @@
+package patterns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"smart-metronome/metronome"
+)
+
+// useTempLibrary направляет каталог пользовательских паттернов во
+// временный каталог и сбрасывает реестр к встроенным паттернам
+func useTempLibrary(t *testing.T) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	patternRegistry = metronome.PredefinedPatterns()
+	t.Cleanup(func() { patternRegistry = metronome.PredefinedPatterns() })
+}
+
+// writePattern пишет во временный каталог файл паттерна name
+func writePattern(t *testing.T, name, fill string) string {
+	t.Helper()
+	pattern := &metronome.Pattern{
+		Name:    name,
+		Beats:   4,
+		Pattern: []metronome.BeatDefinition{{Beat: 1, Sound: "accent", Volume: 1}},
+	}
+	if fill != "" {
+		pattern.Fill = &metronome.Fill{Pattern: fill, Every: 4}
+	}
+	filename := filepath.Join(t.TempDir(), name+".json")
+	if err := pattern.SavePatternToFile(filename); err != nil {
+		t.Fatalf("SavePatternToFile: %v", err)
+	}
+	return filename
+}
+
+func TestImportThenLoad(t *testing.T) {
+	useTempLibrary(t)
+
+	if _, _, err := ImportPattern(writePattern(t, "groove", ""), "", false); err != nil {
+		t.Fatalf("ImportPattern: %v", err)
+	}
+
+	// Как после перезапуска: в реестре только встроенные паттерны
+	patternRegistry = metronome.PredefinedPatterns()
+	if errs := LoadUserPatterns(); len(errs) > 0 {
+		t.Fatalf("LoadUserPatterns: %v", errs)
+	}
+	pattern, err := LoadPattern("groove")
+	if err != nil {
+		t.Fatalf("LoadPattern: %v", err)
+	}
+	if pattern.Name != "groove" || pattern.Beats != 4 {
+		t.Errorf("загружен паттерн %s из %d долей", pattern.Name, pattern.Beats)
+	}
+	if _, ok := GetAllPatterns()["groove"]; !ok {
+		t.Errorf("паттерн не попал в список")
+	}
+}
+
+func TestImportRejectsBuiltinName(t *testing.T) {
+	useTempLibrary(t)
+
+	filename := writePattern(t, "groove", "")
+	for _, replace := range []bool{false, true} {
+		if _, _, err := ImportPattern(filename, "basic", replace); err == nil {
+			t.Errorf("импорт под именем встроенного паттерна (replace=%v) должен завершиться ошибкой", replace)
+		}
+	}
+	if pattern, _ := LoadPattern("basic"); pattern.Name != "basic" {
+		t.Errorf("встроенный паттерн заменен на %s", pattern.Name)
+	}
+}
+
+func TestRenameToExistingName(t *testing.T) {
+	useTempLibrary(t)
+
+	for _, name := range []string{"one", "two"} {
+		if _, _, err := ImportPattern(writePattern(t, name, ""), "", false); err != nil {
+			t.Fatalf("ImportPattern %s: %v", name, err)
+		}
+	}
+
+	if _, err := RenameUserPattern("one", "two"); err == nil {
+		t.Fatalf("переименование в занятое имя должно завершиться ошибкой")
+	}
+	if _, err := RenameUserPattern("one", "basic"); err == nil {
+		t.Errorf("переименование во встроенное имя должно завершиться ошибкой")
+	}
+	for _, name := range []string{"one", "two"} {
+		pattern, err := LoadPattern(name)
+		if err != nil {
+			t.Fatalf("после неудачного переименования: %v", err)
+		}
+		if pattern.Name != name {
+			t.Errorf("паттерн %s теперь называется %s", name, pattern.Name)
+		}
+	}
+}
+
+func TestDeleteMissingPattern(t *testing.T) {
+	useTempLibrary(t)
+
+	if err := DeleteUserPattern("missing"); err == nil {
+		t.Errorf("удаление несуществующего паттерна должно завершиться ошибкой")
+	}
+	if err := DeleteUserPattern("basic"); err == nil {
+		t.Errorf("удаление встроенного паттерна должно завершиться ошибкой")
+	}
+}
+
+func TestLoadUserPatternsResolvesFills(t *testing.T) {
+	useTempLibrary(t)
+
+	dir, err := UserDir()
+	if err != nil {
+		t.Fatalf("UserDir: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Сбивка "a" - пользовательский паттерн "b", который читается позже
+	for name, fill := range map[string]string{"a": "b", "b": "", "c": "missing"} {
+		data, err := os.ReadFile(writePattern(t, name, fill))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errs := LoadUserPatterns()
+	if len(errs) != 1 {
+		t.Fatalf("ожидалась одна ошибка (сбивка c), получено %v", errs)
+	}
+	if _, ok := GetAllPatterns()["c"]; ok {
+		t.Errorf("паттерн с ненайденной сбивкой зарегистрирован")
+	}
+	if _, ok := GetAllPatterns()["a"]; !ok {
+		t.Errorf("паттерн a не зарегистрирован")
+	}
+}
+
+func TestLoadPatternReturnsCopy(t *testing.T) {
+	useTempLibrary(t)
+
+	first, err := LoadPattern("rock")
+	if err != nil {
+		t.Fatalf("LoadPattern: %v", err)
+	}
+	first.Pattern[0].Sound = "ghost"
+	first.Pattern[0].Condition = "50%"
+
+	second, err := LoadPattern("rock")
+	if err != nil {
+		t.Fatalf("LoadPattern: %v", err)
+	}
+	if second == first || second.Pattern[0].Sound == "ghost" || second.Pattern[0].Condition != "" {
+		t.Errorf("изменения одной копии паттерна видны в другой")
+	}
+}
@@ -1,9 +1,12 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"smart-metronome/metronome"
@@ -36,42 +39,98 @@ func RunVisualization(metro *metronome.Metronome) {
 		SetColumns(0).
 		SetBorders(true)
 
+	trainerDisplay := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetDynamicColors(true)
+
 	grid.AddItem(infoDisplay, 0, 0, 1, 1, 0, 0, false)
 	grid.AddItem(beatDisplay, 1, 0, 1, 1, 0, 0, false)
+	grid.AddItem(trainerDisplay, 2, 0, 1, 1, 0, 0, false)
 
 	// Обновляем информацию
 	updateInfo := func() {
 		state := metro.GetState()
 		var status string
-		if running, ok := state["running"].(bool); ok && running {
+		switch state.Transport {
+		case metronome.TransportPlaying:
 			status = "[green]▶ Воспроизведение[white]"
-		} else {
-			status = "[red]⏸ Остановлено[white]"
+		case metronome.TransportPaused:
+			status = "[yellow]⏸ Пауза[white]"
+		default:
+			status = "[red]⏹ Остановлено[white]"
 		}
 
-		info := fmt.Sprintf("[yellow]BPM: %v | Такт: %v/4 | Паттерн: %v | %s",
-			state["bpm"], state["beats_per_bar"], state["pattern"], status)
+		info := fmt.Sprintf("[yellow]BPM: %.1f | Такт: %s | Паттерн: %s | %s",
+			state.Tempo, state.TimeSignature, state.Pattern, status)
+		if state.Section != "" {
+			info += fmt.Sprintf(" | Раздел: [green]%s[-]", state.Section)
+		}
 		infoDisplay.SetText(info)
 	}
 
-	// Подписываемся на события метронома
-	events := metro.Subscribe()
+	// Подписываемся на события метронома до закрытия интерфейса
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub := metro.SubscribeEvents(ctx, metronome.OnlyKinds(metronome.KindBeat,
+		metronome.KindStarted, metronome.KindStopped, metronome.KindModulated))
+	layers := make(map[string]int) // Слой полиритмии -> ударов за такт
 	go func() {
-		for event := range events {
+		for ev := range sub.Events() {
+			if mod, ok := ev.(metronome.Modulated); ok {
+				app.QueueUpdateDraw(func() {
+					trainerDisplay.SetText(modulationText(mod))
+				})
+				continue
+			}
+			beat, ok := ev.(metronome.BeatEvent)
+			if !ok {
+				// Запуск, пауза или остановка - обновляем статус
+				app.QueueUpdateDraw(updateInfo)
+				continue
+			}
+			event := beat.TickEvent
 			app.QueueUpdateDraw(func() {
+				if event.CountIn {
+					beatDisplay.SetText(countInText(event))
+					return
+				}
+
 				// Отображаем текущую долю
 				beatText := ""
-				beatsPerBar := metro.BeatsPerBar
+				beatsPerBar := event.BeatsPerBar
 				for i := 1; i <= beatsPerBar; i++ {
-					if i == event.Beat {
+					beatText += groupBoundary(event.Grouping, i)
+					if i == event.Beat && event.Muted {
+						// Приглушенная доля - показываем, где она
+						beatText += fmt.Sprintf(`["%d"][yellow]◌[""]`, i)
+					} else if i == event.Beat && event.SubBeat == 0 {
 						// Текущая доля - выделяем
-						beatText += fmt.Sprintf(`["%d"][red]●[""] `, i)
+						beatText += fmt.Sprintf(`["%d"][red]●[""]`, i)
+					} else if i == event.Beat {
+						// Звучит подразделение текущей доли
+						beatText += fmt.Sprintf(`["%d"][white]●[""]`, i)
 					} else {
-						beatText += fmt.Sprintf("[gray]○ ")
+						beatText += "[gray]○"
+					}
+
+					if i == event.Beat {
+						beatText += subdivisionText(event)
 					}
+					beatText += " "
+				}
+				beatText += layersText(event, layers)
+				if event.Fill {
+					beatText += " [yellow]сбивка"
+				}
+				if event.LastBar {
+					beatText += " [red]последний такт"
 				}
 				beatDisplay.SetText(beatText)
 
+				if event.Trainer != nil {
+					trainerDisplay.SetText(trainerText(event.Trainer, event.TempoChanged))
+				}
+
 				// Обновляем информацию
 				updateInfo()
 			})
@@ -90,15 +149,14 @@ func RunVisualization(metro *metronome.Metronome) {
 			metro.Stop()
 			return nil
 		case tcell.KeyPause:
-			if metro.Running {
-				metro.Stop()
-			} else {
-				metro.Start()
-			}
+			togglePause(metro)
 			return nil
 		default:
 			// Обработка символов
 			switch event.Rune() {
+			case ' ', 'p', 'P':
+				togglePause(metro)
+				return nil
 			case '+', '=':
 				bpm := metro.BPM + 5
 				if bpm <= 300 {
@@ -114,6 +172,15 @@ func RunVisualization(metro *metronome.Metronome) {
 			case 'r', 'R':
 				metro.Reset()
 				return nil
+			case 'm', 'M', 't', 'T':
+				// Метрическая модуляция с ближайшей тактовой черты
+				mod := hotkeyModulations[event.Rune()]
+				if err := metro.Modulate(mod); err != nil {
+					trainerDisplay.SetText(fmt.Sprintf("[red]%v", err))
+				} else {
+					trainerDisplay.SetText(fmt.Sprintf("[yellow]Модуляция %s со следующего такта", mod))
+				}
+				return nil
 			case 'q', 'Q':
 				app.Stop()
 				metro.Stop()
@@ -129,6 +196,229 @@ func RunVisualization(metro *metronome.Metronome) {
 	}
 }
 
+// hotkeyModulations - метрические модуляции на горячих клавишах
+var hotkeyModulations = map[rune]metronome.MetricModulation{
+	'm': {New: metronome.Quarter, Old: metronome.Quarter * 1.5}, // Новая четверть = старая с точкой
+	'M': {New: metronome.Quarter * 1.5, Old: metronome.Quarter}, // Новая четверть с точкой = старая четверть
+	't': {New: metronome.Eighth, Old: metronome.Quarter / 3},    // Триольная восьмая становится восьмой
+	'T': {New: metronome.Quarter / 3, Old: metronome.Eighth},    // Восьмая становится триольной
+}
+
+// modulationText сообщает о сработавшей метрической модуляции
+func modulationText(mod metronome.Modulated) string {
+	return fmt.Sprintf("[yellow]Модуляция %s: [white]%.1f → [green]%.1f BPM[-] с такта %d",
+		mod.Modulation, mod.From, mod.To, mod.Bar)
+}
+
+// togglePause ставит метроном на паузу или продолжает игру. Остановленный
+// метроном запускается с начала.
+func togglePause(metro *metronome.Metronome) {
+	switch metro.Transport() {
+	case metronome.TransportPlaying:
+		metro.Pause()
+	case metronome.TransportPaused:
+		metro.Resume()
+	default:
+		metro.Play()
+	}
+}
+
+// RunPolyVisualization показывает ансамбль политемпа: у каждого потока
+// своя дорожка с темпом, панорамой и долями
+func RunPolyVisualization(ens *metronome.Ensemble) {
+	app := tview.NewApplication()
+
+	infoDisplay := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetDynamicColors(true).
+		SetText(fmt.Sprintf("[yellow]Политемп: %d потока(ов) | Esc/q - выход", len(ens.Members)))
+
+	rows := make([]int, len(ens.Members)+1)
+	rows[0] = 3
+	grid := tview.NewGrid().
+		SetRows(rows...).
+		SetColumns(0).
+		SetBorders(true)
+	grid.AddItem(infoDisplay, 0, 0, 1, 1, 0, 0, false)
+
+	// Подписки потоков живут до закрытия интерфейса
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i, metro := range ens.Members {
+		lane := tview.NewTextView().SetDynamicColors(true)
+		grid.AddItem(lane, i+1, 0, 1, 1, 0, 0, false)
+
+		label := fmt.Sprintf("[white]Поток %d | %d BPM | %s", i+1, metro.BPM, panText(metro.Pan))
+		lane.SetText(label)
+
+		sub := metro.SubscribeEvents(ctx, metronome.OnlyKinds(metronome.KindBeat))
+		layers := make(map[string]int)
+		go func() {
+			for ev := range sub.Events() {
+				event := ev.(metronome.BeatEvent).TickEvent
+				app.QueueUpdateDraw(func() {
+					beatText := ""
+					for b := 1; b <= event.BeatsPerBar; b++ {
+						switch {
+						case b == event.Beat && event.Muted:
+							beatText += "[yellow]◌"
+						case b == event.Beat && event.SubBeat == 0:
+							beatText += "[red]●"
+						case b == event.Beat:
+							beatText += "[white]●"
+						default:
+							beatText += "[gray]○"
+						}
+						if b == event.Beat {
+							beatText += subdivisionText(event)
+						}
+						beatText += " "
+					}
+					lane.SetText(fmt.Sprintf("%s | такт %d\n%s%s",
+						label, event.Bar, beatText, layersText(event, layers)))
+				})
+			}
+		}()
+	}
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape, tcell.KeyCtrlC:
+			app.Stop()
+			ens.Stop()
+			return nil
+		}
+		switch event.Rune() {
+		case 'q', 'Q':
+			app.Stop()
+			ens.Stop()
+			return nil
+		}
+		return event
+	})
+
+	if err := app.SetRoot(grid, true).SetFocus(grid).Run(); err != nil {
+		panic(err)
+	}
+}
+
+// groupBoundary рисует границу группы аддитивного размера перед долей beat
+func groupBoundary(g *metronome.Grouping, beat int) string {
+	if g == nil || beat == 1 {
+		return ""
+	}
+	if _, start := g.Group(beat); start {
+		return "[blue]│ "
+	}
+	return ""
+}
+
+// countInText рисует такт отсчета: номер такта до начала (-2, -1) и счет
+func countInText(event metronome.TickEvent) string {
+	text := fmt.Sprintf("[yellow]Отсчет %d  ", event.Bar)
+	for i := 1; i <= event.BeatsPerBar; i++ {
+		if i == event.Beat {
+			text += "[red]"
+		} else {
+			text += "[gray]"
+		}
+		if i == event.Beat && event.Count > 0 {
+			text += fmt.Sprintf("%d ", event.Count)
+		} else if i == event.Beat {
+			text += ". "
+		} else {
+			text += "○ "
+		}
+	}
+	return text
+}
+
+// panText описывает положение потока в стереопанораме
+func panText(pan float64) string {
+	switch {
+	case pan < 0:
+		return fmt.Sprintf("L%.0f%%", -pan*100)
+	case pan > 0:
+		return fmt.Sprintf("R%.0f%%", pan*100)
+	default:
+		return "центр"
+	}
+}
+
+// subdivisionText рисует подразделения текущей доли, выделяя звучащее
+func subdivisionText(event metronome.TickEvent) string {
+	text := ""
+	for sub := 1; sub < event.Subdivision; sub++ {
+		if sub == event.SubBeat {
+			text += "[red]•"
+		} else {
+			text += "[gray]·"
+		}
+	}
+	return text
+}
+
+// layersText рисует дорожки слоев полиритмии, выделяя звучащие удары.
+// Слои запоминаются по мере появления их ударов.
+func layersText(event metronome.TickEvent, layers map[string]int) string {
+	current := make(map[string]int)
+	for _, hit := range event.Hits {
+		layers[hit.Layer] = hit.Pulses
+		current[hit.Layer] = hit.Index
+	}
+
+	names := make([]string, 0, len(layers))
+	for name := range layers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	text := ""
+	for _, name := range names {
+		text += fmt.Sprintf("\n[white]%-4s ", name)
+		for i := 1; i <= layers[name]; i++ {
+			if current[name] == i {
+				text += "[red]◆ "
+			} else {
+				text += "[gray]◇ "
+			}
+		}
+	}
+	return text
+}
+
+// trainerText форматирует прогресс тренажера скорости
+func trainerText(status *metronome.TrainerStatus, changed bool) string {
+	var phase string
+	switch status.Phase {
+	case metronome.TrainerBuild:
+		phase = "[green]разгон[-]"
+	case metronome.TrainerCoolDown:
+		phase = "[blue]остывание[-]"
+	case metronome.TrainerDone:
+		phase = "[yellow]завершено[-]"
+	}
+
+	cycles := "∞"
+	if status.Cycles > 0 {
+		cycles = fmt.Sprintf("%d", status.Cycles)
+	}
+
+	tempo := fmt.Sprintf("%d", status.Tempo)
+	if changed {
+		tempo = fmt.Sprintf("[red]%d[-]", status.Tempo)
+	}
+
+	// Полоска прогресса от начального темпа к целевому
+	const width = 20
+	filled := int(math.Round(status.Progress() * width))
+	filled = max(0, min(width, filled))
+	bar := "[green]" + RepeatChar("█", filled) + "[gray]" + RepeatChar("░", width-filled) + "[-]"
+
+	return fmt.Sprintf("Тренажер: %d → %s → %d BPM %s | цикл %d/%s | такт %d/%d | %s",
+		status.Start, tempo, status.Target, bar, status.Cycle, cycles, status.Bar, status.Interval, phase)
+}
+
 type TapTempo struct {
 	taps    []time.Time
 	lastTap time.Time
@@ -298,30 +588,138 @@ func (t *TapTempo) getInitialText() string {
 C - очистить тапы[-]`
 }
 
+// RunCalibration играет clicks щелчков и собирает нажатия пользователя,
+// отстукивающего их пробелом или Enter. Возвращает моменты щелчков и
+// нажатий для metronome.EstimateLatency. Esc прерывает калибровку.
+func RunCalibration(metro *metronome.Metronome, clicks int) (ticks, taps []time.Time, err error) {
+	app := tview.NewApplication()
+	textView := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetDynamicColors(true)
+
+	var mu sync.Mutex
+	cancelled := false
+
+	status := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return fmt.Sprintf(`[yellow]═══════════════════════════════════
+          КАЛИБРОВКА
+═══════════════════════════════════[-]
+
+Нажимайте [green]ПРОБЕЛ[-] или [green]Enter[-] точно со щелчками
+
+Щелчков: %d/%d   Нажатий: %d
+
+[gray]ESC - отмена[-]`, len(ticks), clicks, len(taps))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub := metro.SubscribeEvents(ctx, metronome.OnlyKinds(metronome.KindBeat))
+	go func() {
+		for ev := range sub.Events() {
+			beat := ev.(metronome.BeatEvent)
+			if beat.CountIn {
+				continue
+			}
+
+			mu.Lock()
+			ticks = append(ticks, beat.Timestamp)
+			done := len(ticks) == clicks
+			mu.Unlock()
+
+			app.QueueUpdateDraw(func() { textView.SetText(status()) })
+			if done {
+				// Даем время отстучать последний щелчок
+				time.AfterFunc(time.Second, app.Stop)
+			}
+		}
+	}()
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEscape:
+			mu.Lock()
+			cancelled = true
+			mu.Unlock()
+			app.Stop()
+		case event.Key() == tcell.KeyEnter, event.Rune() == ' ':
+			mu.Lock()
+			taps = append(taps, event.When())
+			mu.Unlock()
+			textView.SetText(status())
+		}
+		return nil
+	})
+
+	if err := metro.Play(); err != nil {
+		return nil, nil, err
+	}
+	defer metro.Stop()
+
+	textView.SetText(status())
+	if err := app.SetRoot(textView, true).Run(); err != nil {
+		return nil, nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if cancelled {
+		return nil, nil, fmt.Errorf("калибровка прервана")
+	}
+	return ticks, taps, nil
+}
+
 // SimpleVisualization - простая визуализация в консоли
 func SimpleVisualization(metro *metronome.Metronome) {
 	fmt.Println("🎵 Простая визуализация метронома")
 	fmt.Println("Нажмите Ctrl+C для выхода")
 
-	events := metro.Subscribe()
+	// Подписка заканчивается вместе с визуализацией
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub := metro.SubscribeEvents(ctx, metronome.OnlyKinds(metronome.KindBeat, metronome.KindStopped))
+
+	for ev := range sub.Events() {
+		if stopped, ok := ev.(metronome.Stopped); ok {
+			if stopped.Paused {
+				continue
+			}
+			return
+		}
+		event := ev.(metronome.BeatEvent).TickEvent
 
-	for event := range events {
 		var symbol string
-		switch event.Sound {
-		case "accent":
+		switch {
+		case event.CountIn && event.Count > 0:
+			symbol = fmt.Sprintf("%d", event.Count)
+		case event.CountIn:
+			symbol = "."
+		case event.Muted:
+			symbol = "·"
+		case event.LayerOnly:
+			symbol = "×"
+		case event.SubBeat > 0:
+			symbol = "-"
+		case event.Sound == "accent":
 			symbol = "█"
-		case "normal":
+		case event.Sound == "normal":
 			symbol = "▓"
-		case "ghost":
+		case event.Sound == "ghost":
 			symbol = "░"
-		case "ride":
+		case event.Sound == "ride":
 			symbol = "◉"
 		default:
 			symbol = "▒"
 		}
 
-		if event.Beat == 1 {
-			fmt.Printf("\n[%03d] ", event.Bar)
+		if event.Beat == 1 && event.SubBeat == 0 {
+			if event.CountIn {
+				fmt.Printf("\n[%3d] ", event.Bar)
+			} else {
+				fmt.Printf("\n[%03d] ", event.Bar)
+			}
 		}
 		fmt.Printf("%s ", symbol)
 	}